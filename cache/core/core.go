@@ -84,6 +84,7 @@ type Found struct {
 	abiEntry     *fastly.CacheEntry
 	state        fastly.CacheLookupState
 	userMetadata []byte
+	lengthKnown  bool
 
 	// Key is the cache key used to find this object.
 	Key []byte
@@ -129,6 +130,7 @@ func newFound(key []byte, e *fastly.CacheEntry, state fastly.CacheLookupState, o
 	}
 
 	length, err := e.Length()
+	lengthKnown := err == nil
 	if err := ignoreNoneError(err); err != nil {
 		return nil, mapFastlyError(err)
 	}
@@ -163,6 +165,7 @@ func newFound(key []byte, e *fastly.CacheEntry, state fastly.CacheLookupState, o
 	return &Found{
 		abiEntry:             e,
 		state:                state,
+		lengthKnown:          lengthKnown,
 		Key:                  key,
 		TTL:                  ttl,
 		Length:               length,
@@ -200,6 +203,16 @@ func (f *Found) UserMetadata() ([]byte, error) {
 	return userMetadata, nil
 }
 
+// Size returns the length of the cached object in bytes, or -1 if it is
+// not known. Together with GetRange, it allows a Found to be served with
+// [fsthttp.ServeRangeReader].
+func (f *Found) Size() int64 {
+	if !f.lengthKnown {
+		return -1
+	}
+	return int64(f.Length)
+}
+
 // GetRange returns an [io.ReadCloser] for the provided range of bytes.
 // The Found's Body must be closed before calling this function, or it
 // will return [ErrInvalidOperation].
@@ -2,6 +2,8 @@ package fsthttp
 
 import (
 	"context"
+	"io"
+	"net"
 	"net/http"
 )
 
@@ -29,6 +31,11 @@ func (w *responseWriterAdapter) WriteHeader(status int) {
 // Because the Request and ResponseWriter types are not exactly the same
 // as ones in net/http, helper accessor functions exist to extract the
 // fsthttp values from the request context.
+//
+// For requests received over TLS, the http.Request's TLS field is
+// populated from TLSInfo and the client certificate, if any. The protocol
+// negotiated with ALPN is not reported by the host, so NegotiatedProtocol is
+// only set, to "h2", for HTTP/2 requests. VerifiedChains is always nil.
 func Adapt(h http.Handler) Handler {
 	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
 		ctx = contextWithRequest(ctx, r)
@@ -45,23 +52,127 @@ func Adapt(h http.Handler) Handler {
 		hr.ProtoMajor = r.ProtoMajor
 		hr.ProtoMinor = r.ProtoMinor
 		hr.Header = http.Header(r.Header.Clone())
+		hr.Trailer = http.Header(r.Trailer)
 		hr.Host = r.Host
 		hr.RemoteAddr = r.RemoteAddr
 		hr.ContentLength = -1
-
-		// TODO: Translate some of fsthttp.TLSInfo into
-		// tls.ConnectionState.
-		//
-		// The protocol version and chosen cipher are available but
-		// provided via the ABI as strings, which we would need to
-		// convert back into integer values.
-		//
-		// The raw ClientHello is provided, so we could use
-		// golang.org/x/crypto/cryptobyte to parse it.  But
-		// server-chosen properties of the connection (cipher, ALPN,
-		// client certificate, etc.) would need to be provided by the
-		// ABI.
+		hr.TLS = connectionState(r)
 
 		h.ServeHTTP(hw, hr)
 	})
 }
+
+// httpResponseWriter is an implementation of fsthttp.ResponseWriter on top
+// of http.ResponseWriter. The Header types share the same underlying map, so
+// trailers are declared and set the same way for both.
+type httpResponseWriter struct {
+	w      http.ResponseWriter
+	closed bool
+}
+
+func (w *httpResponseWriter) Header() Header {
+	return Header(w.w.Header())
+}
+
+func (w *httpResponseWriter) WriteHeader(code int) {
+	w.w.WriteHeader(code)
+}
+
+func (w *httpResponseWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	return w.w.Write(p)
+}
+
+func (w *httpResponseWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// SetManualFramingMode has no effect: net/http always uses a Content-Length
+// set by the handler, and otherwise frames the response itself.
+func (w *httpResponseWriter) SetManualFramingMode(bool) {}
+
+func (w *httpResponseWriter) Append(other io.ReadCloser) error {
+	defer other.Close()
+	if w.closed {
+		return ErrClosed
+	}
+	_, err := io.Copy(w.w, other)
+	return err
+}
+
+// ToHTTP allows an fsthttp.Handler to be used as an http.Handler, so that
+// it can be run by a net/http server, such as an httptest.Server, without
+// being compiled to Wasm.
+//
+// The request's URL is made absolute using its Host, and the scheme of the
+// connection. RemoteAddr and ServerAddr hold only the IP addresses of the
+// connection, as they do on Compute. For requests received over TLS, the
+// protocol version, cipher suite, server name and client certificate are
+// translated into TLSInfo and TLSClientCertificateInfo; the raw ClientHello
+// and the JA3 and JA4 signatures are not available.
+//
+// Request trailers are shared with the http.Request, so they are in
+// Request.Trailer once Body has returned io.EOF. Response trailers are
+// declared and set in the response Header as they are with net/http, either
+// by naming them in a Trailer header before WriteHeader, or by prefixing
+// their keys with TrailerPrefix.
+//
+// Requests sent to backends, and other Compute platform features, are only
+// available if the program is running on Compute or in a test using package
+// fsttest.
+func ToHTTP(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, hr *http.Request) {
+		u := *hr.URL
+		if u.Host == "" {
+			u.Host = hr.Host
+		}
+		if u.Scheme == "" {
+			u.Scheme = "http"
+			if hr.TLS != nil {
+				u.Scheme = "https"
+			}
+		}
+
+		tlsInfo, cert := tlsInfoFromConnectionState(hr.TLS)
+		r := &Request{
+			Method:            hr.Method,
+			URL:               &u,
+			Proto:             hr.Proto,
+			ProtoMajor:        hr.ProtoMajor,
+			ProtoMinor:        hr.ProtoMinor,
+			Header:            Header(hr.Header.Clone()),
+			Body:              hr.Body,
+			Trailer:           Header(hr.Trailer),
+			Host:              hr.Host,
+			RemoteAddr:        hostOnly(hr.RemoteAddr),
+			TLSInfo:           tlsInfo,
+			clientCertificate: cert,
+		}
+		if addr, ok := hr.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			r.ServerAddr = hostOnly(addr.String())
+		}
+		if r.Header == nil {
+			r.Header = NewHeader()
+		}
+
+		fw := &httpResponseWriter{w: w}
+		h.ServeHTTP(hr.Context(), fw, r)
+	})
+}
+
+// hostOnly returns the host part of addr, or addr itself if it has no port.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -6,7 +6,10 @@ package fsthttp_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/fastly/compute-sdk-go/fsthttp"
@@ -29,6 +32,11 @@ func TestAdapter(t *testing.T) {
 			return
 		}
 
+		if got, want := r.Trailer.Get("X-Checksum"), "abc"; got != want {
+			http.Error(w, fmt.Sprintf("trailer X-Checksum = %q, want %q", got, want), http.StatusInternalServerError)
+			return
+		}
+
 		w.WriteHeader(http.StatusTeapot)
 		fmt.Fprintln(w, "Hello, client")
 	})
@@ -38,6 +46,8 @@ func TestAdapter(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	r.Trailer = fsthttp.Header{"X-Checksum": {"abc"}}
+
 	w := fsttest.NewRecorder()
 
 	fsthttp.Adapt(hh).ServeHTTP(context.Background(), w, r)
@@ -50,3 +60,73 @@ func TestAdapter(t *testing.T) {
 		t.Errorf("want body %q, got %q", want, got)
 	}
 }
+
+func TestToHTTP(t *testing.T) {
+	t.Parallel()
+
+	h := fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("X-Scheme", r.URL.Scheme)
+		w.Header().Set("X-Host", r.URL.Host)
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		w.Header().Set("X-Server-Addr", r.ServerAddr)
+		w.Header().Set("X-TLS-Protocol", r.TLSInfo.Protocol)
+		w.Header().Set("X-TLS-Cipher", r.TLSInfo.CipherOpenSSLName)
+		w.Header().Set("X-Greeting", r.Header.Get("X-Greeting"))
+		w.Header().Set("X-Request-Checksum", r.Trailer.Get("X-Request-Checksum"))
+		w.WriteHeader(fsthttp.StatusTeapot)
+		w.Write(body)
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(fsthttp.TrailerPrefix+"X-Late", "def")
+	})
+
+	srv := httptest.NewTLSServer(fsthttp.ToHTTP(h))
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL+"/path", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Greeting", "hello")
+	req.Trailer = http.Header{"X-Request-Checksum": {"xyz"}}
+	req.ContentLength = -1
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := http.StatusTeapot, resp.StatusCode; want != got {
+		t.Errorf("want code %d, got %d", want, got)
+	}
+	if want, got := "payload", string(body); want != got {
+		t.Errorf("want body %q, got %q", want, got)
+	}
+	for k, want := range map[string]string{
+		"X-Scheme":           "https",
+		"X-Host":             strings.TrimPrefix(srv.URL, "https://"),
+		"X-Remote-Addr":      "127.0.0.1",
+		"X-Server-Addr":      "127.0.0.1",
+		"X-TLS-Protocol":     "TLSv1.3",
+		"X-Greeting":         "hello",
+		"X-Request-Checksum": "xyz",
+	} {
+		if got := resp.Header.Get(k); got != want {
+			t.Errorf("header %s: want %q, got %q", k, want, got)
+		}
+	}
+	if got := resp.Header.Get("X-TLS-Cipher"); !strings.HasPrefix(got, "TLS_") {
+		t.Errorf("header X-TLS-Cipher: want a TLS 1.3 cipher suite, got %q", got)
+	}
+	for k, want := range map[string]string{"X-Checksum": "abc", "X-Late": "def"} {
+		if got := resp.Trailer.Get(k); got != want {
+			t.Errorf("trailer %s: want %q, got %q", k, want, got)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 Fastly, Inc.
+
+// Package balancer spreads requests across several backends, skipping
+// backends which are unhealthy.
+//
+// A [Balancer] chooses a backend for each request with a [Strategy]. The
+// backends can be named backends configured for the service, or dynamic
+// backends created with [fsthttp.RegisterDynamicBackend], and can be added
+// and removed while the program runs.
+//
+//	b := balancer.New(balancer.RoundRobin(), "origin-1", "origin-2")
+//	resp, err := b.Send(ctx, req)
+//
+// A Balancer can also be used by an [fsthttp.Transport], by setting its Send
+// field to the Balancer's Send method.
+package balancer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// ErrNoHealthyBackend is returned when every backend of a Balancer is
+// unhealthy, or the Balancer has no backends.
+var ErrNoHealthyBackend = errors.New("balancer: no healthy backend")
+
+// A Candidate is a backend which a Strategy may choose.
+type Candidate struct {
+	// Name is the name of the backend.
+	Name string
+
+	// Weight is the relative weight of the backend, which is at least 1.
+	Weight int
+
+	// Outstanding is the number of requests sent to the backend by the
+	// Balancer which have not yet received a response.
+	Outstanding int
+}
+
+// A Strategy chooses which backend a request is sent to.
+type Strategy interface {
+	// Choose returns the index of the candidate the request should be sent
+	// to. The candidates are the healthy backends of the Balancer, in the
+	// order they were added, and there is at least one. Calls to Choose
+	// by a Balancer are not concurrent.
+	Choose(r *fsthttp.Request, candidates []Candidate) int
+}
+
+// Balancer chooses a backend for each request from a set of backends, using
+// a Strategy.
+//
+// Backends whose health check reports them as unhealthy are skipped, and
+// backends whose health is unknown, such as backends without a health check,
+// are assumed to be healthy.
+//
+// A Balancer may be used by multiple goroutines. Its state persists for as
+// long as the program runs, so with [fsthttp.ServeMany] it is shared by the
+// requests served by the same instance.
+type Balancer struct {
+	strategy Strategy
+
+	mu       sync.Mutex
+	backends []*member
+}
+
+type member struct {
+	name        string
+	weight      int
+	outstanding int
+
+	// backend is looked up on first use, as a dynamic backend may be
+	// added before it is registered.
+	backend *fsthttp.Backend
+}
+
+// New returns a Balancer which chooses between the named backends with the
+// given strategy. Each backend has a weight of 1.
+func New(strategy Strategy, backends ...string) *Balancer {
+	b := &Balancer{strategy: strategy}
+	for _, name := range backends {
+		b.Add(name, 1)
+	}
+	return b
+}
+
+// Add adds the named backend with the given relative weight, which is only
+// used by strategies which take weights into account. A weight less than 1
+// is treated as 1. If the backend has already been added, its weight is
+// updated.
+func (b *Balancer) Add(name string, weight int) {
+	weight = max(weight, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, m := range b.backends {
+		if m.name == name {
+			m.weight = weight
+			return
+		}
+	}
+	b.backends = append(b.backends, &member{name: name, weight: weight})
+}
+
+// Remove removes the named backend.
+func (b *Balancer) Remove(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.backends = slices.DeleteFunc(b.backends, func(m *member) bool { return m.name == name })
+}
+
+// Pick returns the name of the backend the request should be sent to.
+func (b *Balancer) Pick(r *fsthttp.Request) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, err := b.pick(r)
+	if err != nil {
+		return "", err
+	}
+	return m.name, nil
+}
+
+// Send sends the request to the backend chosen for it, as with
+// [fsthttp.Request.Send]. The name of the backend can be found in the
+// Backend field of the response.
+//
+// A request counts as outstanding for its backend until Send returns.
+func (b *Balancer) Send(ctx context.Context, r *fsthttp.Request) (*fsthttp.Response, error) {
+	b.mu.Lock()
+	m, err := b.pick(r)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	m.outstanding++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		m.outstanding--
+		b.mu.Unlock()
+	}()
+	return r.Send(ctx, m.name)
+}
+
+// pick chooses a backend for the request. It must be called with b.mu held.
+func (b *Balancer) pick(r *fsthttp.Request) (*member, error) {
+	var (
+		healthy    []*member
+		candidates []Candidate
+	)
+	for _, m := range b.backends {
+		if m.backend == nil {
+			backend, err := fsthttp.BackendFromName(m.name)
+			if err != nil {
+				continue
+			}
+			m.backend = backend
+		}
+		health, err := m.backend.Health()
+		if err != nil || health == fsthttp.BackendHealthUnhealthy {
+			continue
+		}
+		healthy = append(healthy, m)
+		candidates = append(candidates, Candidate{Name: m.name, Weight: m.weight, Outstanding: m.outstanding})
+	}
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyBackend
+	}
+
+	i := b.strategy.Choose(r, candidates)
+	if i < 0 || i >= len(healthy) {
+		i = 0
+	}
+	return healthy[i], nil
+}
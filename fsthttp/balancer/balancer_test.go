@@ -0,0 +1,216 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func newHost(names ...string) *fsttest.Host {
+	h := fsttest.NewHost()
+	for _, name := range names {
+		h.AddBackend(name, fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	return h
+}
+
+func picks(t *testing.T, b *Balancer, n int, req func(i int) *fsthttp.Request) []string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		r := req(i)
+		if r == nil {
+			r, _ = fsthttp.NewRequest("GET", "https://example.com/", nil)
+		}
+		name, err := b.Pick(r)
+		if err != nil {
+			t.Fatalf("Pick: %v", err)
+		}
+		got = append(got, name)
+	}
+	return got
+}
+
+func noRequest(int) *fsthttp.Request { return nil }
+
+func TestRoundRobin(t *testing.T) {
+	h := newHost("a", "b", "c")
+	defer h.Close()
+
+	b := New(RoundRobin(), "a", "b", "c")
+	if got, want := strings.Join(picks(t, b, 6, noRequest), ","), "a,b,c,a,b,c"; got != want {
+		t.Errorf("picks = %s, want %s", got, want)
+	}
+
+	h.SetBackendHealth("b", fsthttp.BackendHealthUnhealthy)
+	h.SetBackendHealth("c", fsthttp.BackendHealthHealthy)
+	for _, name := range picks(t, b, 6, noRequest) {
+		if name == "b" {
+			t.Errorf("picked unhealthy backend b")
+		}
+	}
+
+	b.Remove("a")
+	b.Remove("c")
+	if _, err := b.Pick(nil); !errors.Is(err, ErrNoHealthyBackend) {
+		t.Errorf("Pick error = %v, want %v", err, ErrNoHealthyBackend)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	h := newHost("a", "b")
+	defer h.Close()
+
+	b := New(Weighted())
+	b.Add("a", 3)
+	b.Add("b", 1)
+	if got, want := strings.Join(picks(t, b, 8, noRequest), ","), "a,a,b,a,a,a,b,a"; got != want {
+		t.Errorf("picks = %s, want %s", got, want)
+	}
+
+	// Removed backends are forgotten.
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("dyn-%d", i)
+		b.Add(name, 1)
+		h.AddBackend(name, fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+		picks(t, b, 1, noRequest)
+		b.Remove(name)
+	}
+	picks(t, b, 1, noRequest)
+	if got := len(b.strategy.(*weighted).current); got != 2 {
+		t.Errorf("weighted strategy state has %d backends, want 2", got)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	h := newHost("a", "b")
+	defer h.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h.AddBackend("slow", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		close(started)
+		<-release
+	}))
+
+	b := New(LeastOutstanding(), "slow", "a")
+	done := make(chan error)
+	go func() {
+		r, _ := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		_, err := b.Send(context.Background(), r)
+		done <- err
+	}()
+	<-started
+
+	for _, name := range picks(t, b, 4, noRequest) {
+		if name != "a" {
+			t.Errorf("picked %s with a request outstanding, want a", name)
+		}
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := picks(t, b, 2, noRequest); got[0] == got[1] {
+		t.Errorf("picks = %v, want both backends once nothing is outstanding", got)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	h := newHost("a", "b", "c")
+	defer h.Close()
+
+	b := New(ConsistentHash(ByHeader("X-User")), "a", "b", "c")
+	req := func(i int) *fsthttp.Request {
+		r, _ := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		r.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+		return r
+	}
+
+	before := picks(t, b, 100, req)
+	if again := picks(t, b, 100, req); strings.Join(again, ",") != strings.Join(before, ",") {
+		t.Errorf("picks changed between calls")
+	}
+	counts := make(map[string]int)
+	for _, name := range before {
+		counts[name]++
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name] == 0 {
+			t.Errorf("backend %s never picked", name)
+		}
+	}
+
+	h.SetBackendHealth("c", fsthttp.BackendHealthUnhealthy)
+	after := picks(t, b, 100, req)
+	for i := range before {
+		switch {
+		case after[i] == "c":
+			t.Errorf("key %d picked unhealthy backend c", i)
+		case before[i] != "c" && after[i] != before[i]:
+			t.Errorf("key %d moved from %s to %s, want only keys on c to move", i, before[i], after[i])
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	r, err := fsthttp.NewRequest("GET", "https://example.com/a?b=c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("X-User", "alice")
+	r.Header.Set("Cookie", "session=s1; other=x")
+
+	for _, tt := range []struct {
+		name string
+		key  func(*fsthttp.Request) string
+		want string
+	}{
+		{"header", ByHeader("X-User"), "alice"},
+		{"missing header", ByHeader("X-Missing"), ""},
+		{"cookie", ByCookie("session"), "s1"},
+		{"missing cookie", ByCookie("missing"), ""},
+		{"url", ByURL(), "example.com/a?b=c"},
+	} {
+		if got := tt.key(r); got != tt.want {
+			t.Errorf("%s: key = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	h := newHost("a", "b")
+	defer h.Close()
+
+	b := New(RoundRobin(), "a", "b")
+	tr := fsthttp.NewTransport("unused")
+	tr.Send = b.Send
+	c := &http.Client{Transport: tr}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		resp, err := c.Get("https://example.com/")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		got = append(got, string(body))
+	}
+	if got, want := strings.Join(got, ","), "a,b,a,b"; got != want {
+		t.Errorf("responses = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2022 Fastly, Inc.
+
+package balancer
+
+import (
+	"hash/fnv"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// StrategyFunc is an adapter to allow the use of an ordinary function as a
+// Strategy.
+type StrategyFunc func(r *fsthttp.Request, candidates []Candidate) int
+
+// Choose calls f(r, candidates).
+func (f StrategyFunc) Choose(r *fsthttp.Request, candidates []Candidate) int {
+	return f(r, candidates)
+}
+
+// RoundRobin returns a Strategy which chooses each healthy backend in turn.
+func RoundRobin() Strategy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (s *roundRobin) Choose(_ *fsthttp.Request, candidates []Candidate) int {
+	return int((s.next.Add(1) - 1) % uint64(len(candidates)))
+}
+
+// Weighted returns a Strategy which chooses each healthy backend in turn, in
+// proportion to its weight. The choices are spread evenly, so a backend with
+// a weight of 3 is not chosen 3 times in a row where it can be avoided.
+func Weighted() Strategy {
+	return &weighted{current: make(map[string]int)}
+}
+
+// weighted implements smooth weighted round-robin, as used by nginx.
+type weighted struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (s *weighted) Choose(_ *fsthttp.Request, candidates []Candidate) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int
+	best := -1
+	for i, c := range candidates {
+		s.current[c.Name] += c.Weight
+		total += c.Weight
+		if best < 0 || s.current[c.Name] > s.current[candidates[best].Name] {
+			best = i
+		}
+	}
+	s.current[candidates[best].Name] -= total
+
+	// Forget backends which are no longer candidates, because they have
+	// been removed or are unhealthy. Every candidate has an entry, so
+	// there are others only if the candidates have changed.
+	if len(s.current) > len(candidates) {
+		for name := range s.current {
+			if !slices.ContainsFunc(candidates, func(c Candidate) bool { return c.Name == name }) {
+				delete(s.current, name)
+			}
+		}
+	}
+	return best
+}
+
+// LeastOutstanding returns a Strategy which chooses the healthy backend with
+// the fewest requests waiting for a response. Ties are broken in turn.
+func LeastOutstanding() Strategy {
+	return &leastOutstanding{}
+}
+
+type leastOutstanding struct {
+	next atomic.Uint64
+}
+
+func (s *leastOutstanding) Choose(_ *fsthttp.Request, candidates []Candidate) int {
+	n := len(candidates)
+	start := int((s.next.Add(1) - 1) % uint64(n))
+	best := start
+	for j := 1; j < n; j++ {
+		i := (start + j) % n
+		if candidates[i].Outstanding < candidates[best].Outstanding {
+			best = i
+		}
+	}
+	return best
+}
+
+// ConsistentHash returns a Strategy which chooses a backend from a key
+// derived from the request, so that requests with the same key go to the same
+// backend while it is healthy. When a backend is added, removed, or becomes
+// unhealthy, only the keys which were chosen for it, or are chosen for it
+// afterwards, move. Backends are chosen in proportion to their weight.
+//
+// Requests for which key returns the empty string are spread round-robin.
+func ConsistentHash(key func(r *fsthttp.Request) string) Strategy {
+	return &consistentHash{key: key}
+}
+
+// consistentHash implements weighted rendezvous hashing.
+type consistentHash struct {
+	key        func(r *fsthttp.Request) string
+	roundRobin roundRobin
+}
+
+func (s *consistentHash) Choose(r *fsthttp.Request, candidates []Candidate) int {
+	k := s.key(r)
+	if k == "" {
+		return s.roundRobin.Choose(r, candidates)
+	}
+
+	best, bestScore := 0, math.Inf(-1)
+	for i, c := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(c.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		// Map the hash to a number in (0, 1), and weight it so that
+		// each backend wins in proportion to its weight.
+		u := (float64(mix(h.Sum64())>>11) + 0.5) / (1 << 53)
+		score := -float64(c.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// mix spreads the bits of an FNV hash, whose high bits vary little between
+// short keys, using the finalizer of SplitMix64.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// ByHeader returns a key function for ConsistentHash which uses the value of
+// the named request header.
+func ByHeader(name string) func(r *fsthttp.Request) string {
+	return func(r *fsthttp.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// ByCookie returns a key function for ConsistentHash which uses the value of
+// the named request cookie.
+func ByCookie(name string) func(r *fsthttp.Request) string {
+	return func(r *fsthttp.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// ByURL returns a key function for ConsistentHash which uses the host, path
+// and query of the request URL.
+func ByURL() func(r *fsthttp.Request) string {
+	return func(r *fsthttp.Request) string {
+		if r.URL == nil {
+			return ""
+		}
+		return r.URL.Host + r.URL.RequestURI()
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/erl"
+)
+
+// CircuitState is the state of a circuit breaker for a backend.
+type CircuitState int
+
+const (
+	// CircuitClosed means requests are sent to the backend.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen means the backend has failed too often, and requests are
+	// not sent to it.
+	CircuitOpen
+
+	// CircuitHalfOpen means the circuit has been open for long enough that
+	// a limited number of trial requests are sent to the backend, to find
+	// out whether it has recovered.
+	CircuitHalfOpen
+)
+
+// String implements fmt.Stringer.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenError is returned by [CircuitBreaker.Send] when the circuit for
+// the backend is open, and there is no fallback backend. The request was not
+// sent, and may be sent elsewhere.
+type CircuitOpenError struct {
+	// Backend is the name of the backend whose circuit is open.
+	Backend string
+
+	// RetryAfter is how long it will be until the circuit becomes
+	// half-open, or zero if it is half-open already.
+	RetryAfter time.Duration
+}
+
+// Error implements error.
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("fsthttp: circuit open for backend %q", e.Backend)
+}
+
+// CircuitBreaker stops sending requests to a backend which keeps failing,
+// giving it time to recover, and failing fast rather than waiting for
+// requests which are likely to fail.
+//
+// The circuit for each backend starts closed. After FailureThreshold
+// consecutive failures it opens, and requests are failed with a
+// *CircuitOpenError, or sent to the Fallback backend, for OpenDuration. The
+// circuit is then half-open: up to HalfOpenRequests trial requests are sent
+// to the backend. If they all succeed the circuit closes, and if any fails it
+// opens again.
+//
+// The zero value is ready to use with the default settings, and may be used
+// by multiple goroutines. A CircuitBreaker's state persists for as long as
+// the program runs, so one stored in a package-level variable is shared by
+// the requests served by the same instance with [ServeMany].
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures which open
+	// the circuit. If zero, the threshold is 5.
+	FailureThreshold int
+
+	// OpenDuration is how long the circuit stays open before it becomes
+	// half-open. If zero, the duration is 30s.
+	OpenDuration time.Duration
+
+	// HalfOpenRequests is the number of trial requests sent while the
+	// circuit is half-open. If zero, one trial request is sent.
+	HalfOpenRequests int
+
+	// IsFailure reports whether the result of sending a request counts as
+	// a failure of the backend. If nil, a [SendError] whose cause is
+	// SendErrorConnectionRefused or SendErrorConnectionTimeout, or a
+	// response with a 5xx status code, is a failure.
+	//
+	// Errors which are not a SendError, such as the request's context
+	// being cancelled, say nothing about the backend, and count as
+	// neither a success nor a failure. IsFailure is not called for
+	// context errors, and with the default IsFailure this applies to
+	// every error which is not a SendError.
+	IsFailure func(resp *Response, err error) bool
+
+	// Fallback is the name of a backend to which requests are sent while
+	// the circuit is open. If empty, requests fail with a
+	// *CircuitOpenError instead.
+	Fallback string
+
+	// Counter is an optional rate counter used to share failures between
+	// the instances of the service in a POP. Each failure is counted for
+	// the backend's name, and the circuit also opens when
+	// CounterThreshold failures have been counted in the most recent 10
+	// second bucket. Looking up the count adds a hostcall to each request
+	// sent while the circuit is closed. If nil, failures are only counted
+	// by this instance.
+	Counter *erl.RateCounter
+
+	// CounterThreshold is the number of failures counted by Counter in
+	// the most recent 10 second bucket which opens the circuit. If zero,
+	// FailureThreshold is used.
+	CounterThreshold uint32
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int       // consecutive failures while closed
+	openedAt  time.Time // when the circuit last opened
+	trials    int       // trial requests started while half-open
+	successes int       // successful trial requests while half-open
+}
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenDuration     = 30 * time.Second
+)
+
+// Send sends the request to the named backend like [Request.Send], unless
+// the backend's circuit is open. Then the request is sent to the Fallback
+// backend, or Send returns a *CircuitOpenError without sending it.
+func (cb *CircuitBreaker) Send(ctx context.Context, req *Request, backend string) (*Response, error) {
+	retryAfter, ok := cb.allow(backend)
+	if ok && cb.sharedOpen(backend) {
+		cb.trip(backend)
+		retryAfter, ok = cb.openDuration(), false
+	}
+	if !ok {
+		if cb.Fallback != "" {
+			return req.Send(ctx, cb.Fallback)
+		}
+		return nil, &CircuitOpenError{Backend: backend, RetryAfter: retryAfter}
+	}
+
+	resp, err := req.Send(ctx, backend)
+	result := cb.result(resp, err)
+	cb.record(backend, result)
+	if result == resultFailure && cb.Counter != nil {
+		cb.Counter.Increment(backend, 1)
+	}
+	return resp, err
+}
+
+// State returns the state of the named backend's circuit.
+func (cb *CircuitBreaker) State(backend string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuits[backend]
+	if c == nil {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= cb.openDuration() {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow reports whether a request may be sent to the backend and, if not,
+// how long it will be until the circuit becomes half-open.
+func (cb *CircuitBreaker) allow(backend string) (time.Duration, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(backend)
+
+	if c.state == CircuitOpen {
+		remaining := cb.openDuration() - time.Since(c.openedAt)
+		if remaining > 0 {
+			return remaining, false
+		}
+		c.state = CircuitHalfOpen
+		c.trials = 0
+		c.successes = 0
+	}
+	if c.state == CircuitHalfOpen {
+		if c.trials >= cb.halfOpenRequests() {
+			return 0, false
+		}
+		c.trials++
+	}
+	return 0, true
+}
+
+// sharedOpen reports whether the failures counted by the Counter for the
+// backend have reached the CounterThreshold, while its circuit is closed.
+func (cb *CircuitBreaker) sharedOpen(backend string) bool {
+	if cb.Counter == nil || cb.State(backend) != CircuitClosed {
+		return false
+	}
+	threshold := cb.CounterThreshold
+	if threshold == 0 {
+		threshold = uint32(cb.failureThreshold())
+	}
+	n, err := cb.Counter.LookupCount(backend, erl.CounterDuration10s)
+	return err == nil && n >= threshold
+}
+
+// record updates the backend's circuit with the result of a request.
+func (cb *CircuitBreaker) record(backend string, result sendResult) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(backend)
+
+	if result == resultIgnored {
+		// Release the trial slot, so that another request can find out
+		// whether the backend has recovered.
+		if c.state == CircuitHalfOpen && c.trials > 0 {
+			c.trials--
+		}
+		return
+	}
+	failed := result == resultFailure
+
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= cb.failureThreshold() {
+			c.open()
+		}
+	case CircuitHalfOpen:
+		if failed {
+			c.open()
+			return
+		}
+		c.successes++
+		if c.successes >= cb.halfOpenRequests() {
+			*c = circuit{state: CircuitClosed}
+		}
+	}
+}
+
+// trip opens the backend's circuit.
+func (cb *CircuitBreaker) trip(backend string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.circuit(backend).open()
+}
+
+// circuit returns the backend's circuit. It must be called with cb.mu held.
+func (cb *CircuitBreaker) circuit(backend string) *circuit {
+	c := cb.circuits[backend]
+	if c == nil {
+		if cb.circuits == nil {
+			cb.circuits = make(map[string]*circuit)
+		}
+		c = &circuit{state: CircuitClosed}
+		cb.circuits[backend] = c
+	}
+	return c
+}
+
+func (c *circuit) open() {
+	*c = circuit{state: CircuitOpen, openedAt: time.Now()}
+}
+
+// sendResult is what the result of sending a request says about the
+// backend.
+type sendResult int
+
+const (
+	resultSuccess sendResult = iota
+	resultFailure
+	resultIgnored
+)
+
+func (cb *CircuitBreaker) result(resp *Response, err error) sendResult {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return resultIgnored
+	}
+	if cb.IsFailure != nil {
+		if cb.IsFailure(resp, err) {
+			return resultFailure
+		}
+		return resultSuccess
+	}
+	if err != nil {
+		var se SendError
+		if !errors.As(err, &se) {
+			return resultIgnored
+		}
+		if se.Cause() == SendErrorConnectionRefused || se.Cause() == SendErrorConnectionTimeout {
+			return resultFailure
+		}
+		return resultSuccess
+	}
+	if resp.StatusCode >= 500 {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.FailureThreshold <= 0 {
+		return defaultCircuitFailureThreshold
+	}
+	return cb.FailureThreshold
+}
+
+func (cb *CircuitBreaker) openDuration() time.Duration {
+	if cb.OpenDuration <= 0 {
+		return defaultCircuitOpenDuration
+	}
+	return cb.OpenDuration
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests <= 0 {
+		return 1
+	}
+	return cb.HalfOpenRequests
+}
@@ -0,0 +1,169 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	var code int
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		w.WriteHeader(code)
+	}))
+	h.AddBackend("fallback", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		w.WriteHeader(fsthttp.StatusNonAuthoritativeInfo)
+	}))
+
+	cb := &fsthttp.CircuitBreaker{FailureThreshold: 3, OpenDuration: 20 * time.Millisecond}
+	send := func() (*fsthttp.Response, error) {
+		t.Helper()
+		req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cb.Send(context.Background(), req, "origin")
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+	wantState := func(want fsthttp.CircuitState) {
+		t.Helper()
+		if got := cb.State("origin"); got != want {
+			t.Fatalf("State = %v, want %v", got, want)
+		}
+	}
+
+	// Failures which aren't consecutive don't open the circuit.
+	code = fsthttp.StatusServiceUnavailable
+	send()
+	send()
+	code = fsthttp.StatusOK
+	send()
+	wantState(fsthttp.CircuitClosed)
+
+	h.FailBackend("origin", fsthttp.SendErrorConnectionRefused, 2)
+	send()
+	send()
+	code = fsthttp.StatusInternalServerError
+	send()
+	wantState(fsthttp.CircuitOpen)
+
+	_, err := send()
+	var coe *fsthttp.CircuitOpenError
+	if !errors.As(err, &coe) || coe.Backend != "origin" || coe.RetryAfter <= 0 {
+		t.Fatalf("Send error = %v, want CircuitOpenError", err)
+	}
+
+	// A failed trial request opens the circuit again.
+	time.Sleep(30 * time.Millisecond)
+	wantState(fsthttp.CircuitHalfOpen)
+	if resp, _ := send(); resp == nil || resp.StatusCode != fsthttp.StatusInternalServerError {
+		t.Fatalf("trial request not sent to origin")
+	}
+	wantState(fsthttp.CircuitOpen)
+
+	// A successful trial request closes it.
+	time.Sleep(30 * time.Millisecond)
+	code = fsthttp.StatusOK
+	if _, err := send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	wantState(fsthttp.CircuitClosed)
+
+	// While open, requests go to the fallback backend.
+	cb.Fallback = "fallback"
+	h.FailBackend("origin", fsthttp.SendErrorConnectionTimeout, 3)
+	for i := 0; i < 3; i++ {
+		send()
+	}
+	wantState(fsthttp.CircuitOpen)
+	resp, err := send()
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp.Backend != "fallback" || resp.StatusCode != fsthttp.StatusNonAuthoritativeInfo {
+		t.Errorf("response from %q with status %d, want fallback", resp.Backend, resp.StatusCode)
+	}
+}
+
+func TestCircuitBreakerIgnoredErrors(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+	h.FailBackend("origin", fsthttp.SendErrorTLSCertificateError, -1)
+
+	var cb fsthttp.CircuitBreaker
+	for i := 0; i < 10; i++ {
+		req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cb.Send(context.Background(), req, "origin"); err == nil {
+			t.Fatalf("Send succeeded, want error")
+		}
+	}
+	if got := cb.State("origin"); got != fsthttp.CircuitClosed {
+		t.Errorf("State = %v, want %v", got, fsthttp.CircuitClosed)
+	}
+}
+
+func TestCircuitBreakerHalfOpenCancelled(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+
+	cb := &fsthttp.CircuitBreaker{FailureThreshold: 1, OpenDuration: 20 * time.Millisecond}
+	send := func(ctx context.Context) error {
+		t.Helper()
+		req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cb.Send(ctx, req, "origin")
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	h.FailBackend("origin", fsthttp.SendErrorConnectionRefused, 1)
+	send(context.Background())
+	if got, want := cb.State("origin"), fsthttp.CircuitOpen; got != want {
+		t.Fatalf("State = %v, want %v", got, want)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// A cancelled trial request neither closes nor opens the circuit, and
+	// releases its trial slot.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := send(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send error = %v, want %v", err, context.Canceled)
+	}
+	if got, want := cb.State("origin"), fsthttp.CircuitHalfOpen; got != want {
+		t.Fatalf("State after cancelled trial = %v, want %v", got, want)
+	}
+
+	if err := send(context.Background()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got, want := cb.State("origin"), fsthttp.CircuitClosed; got != want {
+		t.Errorf("State after successful trial = %v, want %v", got, want)
+	}
+}
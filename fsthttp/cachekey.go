@@ -0,0 +1,218 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+// httpCacheGetSuggestedCacheKey is the hostcall behind SuggestedCacheKey,
+// replaced in tests.
+var httpCacheGetSuggestedCacheKey = fastly.HTTPCacheGetSuggestedCacheKey
+
+// SuggestedCacheKey returns the cache key Fastly would use to cache the
+// response to the request, based on its method, URL and headers as they
+// are now. The key is 32 bytes long. To derive a CacheOptions.OverrideKey
+// from the default key with a normalised query, use
+// CacheKeyBuilder.SuggestedBase.
+func (req *Request) SuggestedCacheKey() ([]byte, error) {
+	abiReq, err := fastly.NewHTTPRequest()
+	if err != nil {
+		return nil, fmt.Errorf("construct request: %w", err)
+	}
+	defer abiReq.Close()
+
+	if err := abiReq.SetMethod(req.Method); err != nil {
+		return nil, fmt.Errorf("set method: %w", err)
+	}
+	if err := abiReq.SetURI(req.URL.String()); err != nil {
+		return nil, fmt.Errorf("set URL: %w", err)
+	}
+	for _, key := range req.Header.Keys() {
+		if err := abiReq.SetHeaderValues(key, req.Header.Values(key)); err != nil {
+			return nil, fmt.Errorf("set headers: %w", err)
+		}
+	}
+
+	key, err := httpCacheGetSuggestedCacheKey(abiReq)
+	if err != nil {
+		return nil, fmt.Errorf("get suggested cache key: %w", err)
+	}
+	return key, nil
+}
+
+// CacheKeyBuilder builds a cache key from the parts of a request which
+// affect its response, for use as CacheOptions.OverrideKey or as a key for
+// the cache/core package. The key is derived from the request host and
+// path, or from a base key such as the suggested cache key, followed by the
+// selected query parameters, headers, cookies and values:
+//
+//	key := fsthttp.NewCacheKeyBuilder(r).
+//		IncludeQuery("page", "sort").
+//		Header("Accept-Language").
+//		Value(deviceClass)
+//	r.CacheOptions.OverrideKey = key.OverrideKey()
+//
+// The key is computed when Key or OverrideKey is called, from the request
+// as it is then. It is the same for requests which differ only in the
+// order of their query parameters, in parts not selected by the builder,
+// or in the case of header names.
+type CacheKeyBuilder struct {
+	req          *Request
+	base         []byte
+	includeQuery map[string]bool
+	excludeQuery map[string]bool
+	headers      []string
+	cookies      []string
+	values       []string
+}
+
+// NewCacheKeyBuilder returns a CacheKeyBuilder for the request r. By
+// default, the key is made of the host and path of r and all its query
+// parameters.
+func NewCacheKeyBuilder(r *Request) *CacheKeyBuilder {
+	return &CacheKeyBuilder{req: r}
+}
+
+// Base sets the key to start from in place of the host and path of the
+// request. The key should not depend on the query of the request, or the
+// query parameters removed with IncludeQuery and ExcludeQuery will still
+// affect the result; use SuggestedBase to start from the suggested cache
+// key.
+func (b *CacheKeyBuilder) Base(key []byte) *CacheKeyBuilder {
+	b.base = append([]byte(nil), key...)
+	return b
+}
+
+// SuggestedBase sets the key to start from to the suggested cache key of
+// a copy of the request whose query holds only the selected parameters,
+// sorted by name. The query parameters must be selected before calling
+// it:
+//
+//	b, err := fsthttp.NewCacheKeyBuilder(r).ExcludeQuery("utm_source").SuggestedBase()
+//	if err != nil {
+//		// ...
+//	}
+//	r.CacheOptions.OverrideKey = b.Header("Accept-Language").OverrideKey()
+func (b *CacheKeyBuilder) SuggestedBase() (*CacheKeyBuilder, error) {
+	r := b.req.Clone()
+	r.URL.RawQuery = b.query()
+	key, err := r.SuggestedCacheKey()
+	if err != nil {
+		return b, err
+	}
+	return b.Base(key), nil
+}
+
+// IncludeQuery restricts the query parameters which are part of the key to
+// those with the given names. It may be called more than once to include
+// more names. Called with no names, it excludes all query parameters.
+func (b *CacheKeyBuilder) IncludeQuery(names ...string) *CacheKeyBuilder {
+	if b.includeQuery == nil {
+		b.includeQuery = make(map[string]bool)
+	}
+	for _, name := range names {
+		b.includeQuery[name] = true
+	}
+	return b
+}
+
+// ExcludeQuery removes the query parameters with the given names from the
+// key, for example tracking parameters which do not affect the response.
+func (b *CacheKeyBuilder) ExcludeQuery(names ...string) *CacheKeyBuilder {
+	if b.excludeQuery == nil {
+		b.excludeQuery = make(map[string]bool)
+	}
+	for _, name := range names {
+		b.excludeQuery[name] = true
+	}
+	return b
+}
+
+// Header adds the values of the named request header to the key.
+func (b *CacheKeyBuilder) Header(name string) *CacheKeyBuilder {
+	b.headers = append(b.headers, CanonicalHeaderKey(name))
+	return b
+}
+
+// Cookie adds the value of the named request cookie to the key.
+func (b *CacheKeyBuilder) Cookie(name string) *CacheKeyBuilder {
+	b.cookies = append(b.cookies, name)
+	return b
+}
+
+// Value adds an arbitrary value to the key, such as a device class
+// computed by the handler.
+func (b *CacheKeyBuilder) Value(v string) *CacheKeyBuilder {
+	b.values = append(b.values, v)
+	return b
+}
+
+// Key returns the 32-byte SHA-256 digest of the selected parts of the
+// request. It can be used directly as a cache/core key.
+func (b *CacheKeyBuilder) Key() []byte {
+	h := sha256.New()
+	if b.base != nil {
+		writeKeyPart(h, 'b', string(b.base))
+	} else {
+		writeKeyPart(h, 'h', strings.ToLower(b.req.URL.Host))
+		writeKeyPart(h, 'p', b.req.URL.EscapedPath())
+	}
+	writeKeyPart(h, 'q', b.query())
+	for _, name := range b.headers {
+		writeKeyPart(h, 'H', name)
+		vals := b.req.Header.Values(name)
+		writeKeyPart(h, 'n', strconv.Itoa(len(vals)))
+		for _, v := range vals {
+			writeKeyPart(h, 'v', v)
+		}
+	}
+	for _, name := range b.cookies {
+		writeKeyPart(h, 'C', name)
+		if c, err := b.req.Cookie(name); err == nil {
+			writeKeyPart(h, 'v', c.Value)
+		} else {
+			writeKeyPart(h, '-', "")
+		}
+	}
+	for _, v := range b.values {
+		writeKeyPart(h, 'V', v)
+	}
+	return h.Sum(nil)
+}
+
+// OverrideKey returns the key in the form expected by
+// CacheOptions.OverrideKey.
+func (b *CacheKeyBuilder) OverrideKey() string {
+	return string(b.Key())
+}
+
+// query returns the selected query parameters of the request, sorted by
+// name and encoded.
+func (b *CacheKeyBuilder) query() string {
+	q, _ := url.ParseQuery(b.req.URL.RawQuery)
+	for name := range q {
+		if (b.includeQuery != nil && !b.includeQuery[name]) || b.excludeQuery[name] {
+			delete(q, name)
+		}
+	}
+	return q.Encode()
+}
+
+// writeKeyPart writes a tagged, length-prefixed part of a cache key to h,
+// so that no two different sequences of parts are written the same way.
+func writeKeyPart(h hash.Hash, tag byte, s string) {
+	var buf [1 + binary.MaxVarintLen64]byte
+	buf[0] = tag
+	n := binary.PutUvarint(buf[1:], uint64(len(s)))
+	h.Write(buf[:1+n])
+	h.Write([]byte(s))
+}
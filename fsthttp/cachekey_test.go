@@ -0,0 +1,134 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+func TestCacheKeyBuilder(t *testing.T) {
+	t.Parallel()
+
+	newReq := func(url string, headers ...string) *Request {
+		t.Helper()
+		r, err := NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Add(headers[i], headers[i+1])
+		}
+		return r
+	}
+
+	base := newReq("https://example.com/products?sort=price&page=2&utm_source=ad",
+		"Accept-Language", "en",
+		"Cookie", "currency=EUR; session=abc",
+	)
+	build := func(r *Request) *CacheKeyBuilder {
+		return NewCacheKeyBuilder(r).
+			ExcludeQuery("utm_source").
+			Header("accept-language").
+			Cookie("currency").
+			Value("mobile")
+	}
+	want := build(base).Key()
+	if len(want) != 32 {
+		t.Fatalf("key length = %d, want 32", len(want))
+	}
+	if got := build(base).OverrideKey(); got != string(want) {
+		t.Errorf("OverrideKey = %x, want %x", got, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		req  *Request
+		same bool
+	}{
+		{"reordered query", newReq("https://example.com/products?page=2&sort=price", "Accept-Language", "en", "Cookie", "session=xyz; currency=EUR"), true},
+		{"excluded query", newReq("https://EXAMPLE.com/products?page=2&utm_source=mail&sort=price", "Accept-Language", "en", "Cookie", "currency=EUR"), true},
+		{"other query", newReq("https://example.com/products?page=3&sort=price", "Accept-Language", "en", "Cookie", "currency=EUR"), false},
+		{"other path", newReq("https://example.com/product?page=2&sort=price", "Accept-Language", "en", "Cookie", "currency=EUR"), false},
+		{"other host", newReq("https://example.org/products?page=2&sort=price", "Accept-Language", "en", "Cookie", "currency=EUR"), false},
+		{"other header", newReq("https://example.com/products?page=2&sort=price", "Accept-Language", "fr", "Cookie", "currency=EUR"), false},
+		{"missing header", newReq("https://example.com/products?page=2&sort=price", "Cookie", "currency=EUR"), false},
+		{"other cookie", newReq("https://example.com/products?page=2&sort=price", "Accept-Language", "en", "Cookie", "currency=USD"), false},
+		{"missing cookie", newReq("https://example.com/products?page=2&sort=price", "Accept-Language", "en"), false},
+	} {
+		if got := build(tt.req).Key(); bytes.Equal(got, want) != tt.same {
+			t.Errorf("%s: same key = %v, want %v", tt.name, !tt.same, tt.same)
+		}
+	}
+
+	// Only the included query parameters are part of the key.
+	include := func(r *Request) []byte { return NewCacheKeyBuilder(r).IncludeQuery("page").Key() }
+	if !bytes.Equal(include(base), include(newReq("https://example.com/products?page=2&sort=name"))) {
+		t.Errorf("IncludeQuery: keys differ in a parameter not included")
+	}
+	if bytes.Equal(include(base), include(newReq("https://example.com/products?page=3"))) {
+		t.Errorf("IncludeQuery: keys equal for different included parameters")
+	}
+	none := func(r *Request) []byte { return NewCacheKeyBuilder(r).IncludeQuery().Key() }
+	if !bytes.Equal(none(base), none(newReq("https://example.com/products"))) {
+		t.Errorf("IncludeQuery(): keys differ in query")
+	}
+
+	// A base key replaces the host and path.
+	suggested := bytes.Repeat([]byte{1}, 32)
+	withBase := func(r *Request) []byte { return NewCacheKeyBuilder(r).Base(suggested).Value("mobile").Key() }
+	if !bytes.Equal(withBase(newReq("https://example.com/a")), withBase(newReq("https://example.org/b"))) {
+		t.Errorf("Base: keys differ in host and path")
+	}
+	if bytes.Equal(withBase(newReq("https://example.com/a")), NewCacheKeyBuilder(newReq("https://example.com/a")).Value("mobile").Key()) {
+		t.Errorf("Base: key equal to key without base")
+	}
+
+	// Values are not ambiguous.
+	if bytes.Equal(NewCacheKeyBuilder(base).Value("ab").Value("c").Key(), NewCacheKeyBuilder(base).Value("a").Value("bc").Key()) {
+		t.Errorf("Value: keys equal for different values")
+	}
+}
+
+func TestCacheKeyBuilderSuggestedBase(t *testing.T) {
+	orig := httpCacheGetSuggestedCacheKey
+	t.Cleanup(func() { httpCacheGetSuggestedCacheKey = orig })
+	var uris []string
+	httpCacheGetSuggestedCacheKey = func(req *fastly.HTTPRequest) ([]byte, error) {
+		uri, err := req.GetURI()
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, uri)
+		sum := sha256.Sum256([]byte(uri))
+		return sum[:], nil
+	}
+
+	key := func(url string) []byte {
+		t.Helper()
+		r, err := NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewCacheKeyBuilder(r).ExcludeQuery("utm_source").SuggestedBase()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Key()
+	}
+
+	a := key("https://example.com/products?sort=price&utm_source=ad&page=2")
+	b := key("https://example.com/products?page=2&sort=price&utm_source=mail")
+	if !bytes.Equal(a, b) {
+		t.Errorf("keys differ in an excluded query parameter")
+	}
+	if want := "https://example.com/products?page=2&sort=price"; len(uris) != 2 || uris[0] != want || uris[1] != want {
+		t.Errorf("suggested key URLs = %q, want %q twice", uris, want)
+	}
+	if c := key("https://example.com/products?page=3&sort=price"); bytes.Equal(a, c) {
+		t.Errorf("keys equal for different query parameters")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ComplianceRegion is the compliance region of a client request, which
+// determines where the data of the request may be processed and stored.
+type ComplianceRegion int
+
+const (
+	// ComplianceRegionNone indicates the request is not subject to a
+	// compliance region.
+	ComplianceRegionNone ComplianceRegion = iota
+
+	// ComplianceRegionUS indicates the request must be handled in the
+	// United States.
+	ComplianceRegionUS
+
+	// ComplianceRegionEU indicates the request must be handled in the
+	// European Union.
+	ComplianceRegionEU
+
+	// ComplianceRegionUnknown indicates the request has a compliance region
+	// not recognized by this SDK version.
+	ComplianceRegionUnknown
+)
+
+// String implements fmt.Stringer.
+func (c ComplianceRegion) String() string {
+	switch c {
+	case ComplianceRegionNone:
+		return "none"
+	case ComplianceRegionUS:
+		return "us"
+	case ComplianceRegionEU:
+		return "eu"
+	}
+	return "unknown"
+}
+
+func parseComplianceRegion(s string) ComplianceRegion {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return ComplianceRegionNone
+	case "us":
+		return ComplianceRegionUS
+	case "eu":
+		return ComplianceRegionEU
+	}
+	return ComplianceRegionUnknown
+}
+
+// ComplianceRegion returns the compliance region of the client request.
+//
+// It returns an error if the request is not the client request.
+func (r *Request) ComplianceRegion() (ComplianceRegion, error) {
+	if r.downstream.req == nil {
+		return ComplianceRegionNone, fmt.Errorf("downstream request not available")
+	}
+
+	s, err := r.downstream.req.DownstreamComplianceRegion()
+	if err = ignoreNoneError(err); err != nil {
+		return ComplianceRegionNone, fmt.Errorf("get compliance region: %w", err)
+	}
+	return parseComplianceRegion(s), nil
+}
+
+// ErrNoRegionRoute is returned by RegionRouter when no route may be used for
+// a compliance region.
+var ErrNoRegionRoute = errors.New("fsthttp: no route for compliance region")
+
+// RegionRoute names the resources used to handle requests from a
+// compliance region. Empty names are left for the caller to handle.
+type RegionRoute struct {
+	// Backend is the name of the backend to send requests to.
+	Backend string
+
+	// KVStore is the name of the KV store to open with kvstore.Open.
+	KVStore string
+
+	// LogEndpoint is the name of the log endpoint to open with
+	// rtlog.Open.
+	LogEndpoint string
+}
+
+// RegionFallback is the policy a RegionRouter applies to a compliance
+// region which has no route.
+type RegionFallback int
+
+const (
+	// RegionFallbackDeny returns ErrNoRegionRoute for a region without a
+	// route. It is the default, so that data subject to a compliance
+	// region is never sent elsewhere by mistake.
+	RegionFallbackDeny RegionFallback = iota
+
+	// RegionFallbackGlobal uses the route for ComplianceRegionNone for a
+	// region without a route.
+	RegionFallbackGlobal
+
+	// RegionFallbackGlobalExceptEU uses the route for ComplianceRegionNone
+	// for a region without a route, other than ComplianceRegionEU, for
+	// which it returns ErrNoRegionRoute.
+	RegionFallbackGlobalExceptEU
+)
+
+// RegionRouter chooses the backend, KV store and log endpoint used to
+// handle a request according to its compliance region, so that, for
+// example, requests from the EU are handled on EU infrastructure:
+//
+//	router := &fsthttp.RegionRouter{
+//		Routes: map[fsthttp.ComplianceRegion]fsthttp.RegionRoute{
+//			fsthttp.ComplianceRegionNone: {Backend: "origin", KVStore: "sessions", LogEndpoint: "logs"},
+//			fsthttp.ComplianceRegionEU:   {Backend: "origin-eu", KVStore: "sessions-eu", LogEndpoint: "logs-eu"},
+//		},
+//		Fallback: fsthttp.RegionFallbackGlobalExceptEU,
+//	}
+//
+//	route, err := router.RouteRequest(r)
+//	if err != nil {
+//		fsthttp.WriteProblem(w, r, fsthttp.NewProblem(fsthttp.StatusServiceUnavailable, "Region not served."))
+//		return
+//	}
+//	resp, err := r.Send(ctx, route.Backend)
+type RegionRouter struct {
+	// Routes holds the route for each compliance region. The route for
+	// ComplianceRegionNone is used for requests without a compliance
+	// region, and by the fallback policies.
+	Routes map[ComplianceRegion]RegionRoute
+
+	// Fallback is the policy for regions without a route.
+	Fallback RegionFallback
+}
+
+// Route returns the route for the compliance region, applying the fallback
+// policy if the region has no route.
+func (rr *RegionRouter) Route(region ComplianceRegion) (RegionRoute, error) {
+	if route, ok := rr.Routes[region]; ok {
+		return route, nil
+	}
+	switch rr.Fallback {
+	case RegionFallbackGlobalExceptEU:
+		if region == ComplianceRegionEU {
+			break
+		}
+		fallthrough
+	case RegionFallbackGlobal:
+		if route, ok := rr.Routes[ComplianceRegionNone]; ok {
+			return route, nil
+		}
+	}
+	return RegionRoute{}, fmt.Errorf("%w %v", ErrNoRegionRoute, region)
+}
+
+// RouteRequest returns the route for the compliance region of the client
+// request r. If the region cannot be determined, no route is used whatever
+// the fallback policy, and the error wraps both ErrNoRegionRoute and the
+// error from Request.ComplianceRegion.
+func (rr *RegionRouter) RouteRequest(r *Request) (RegionRoute, error) {
+	region, err := r.ComplianceRegion()
+	if err != nil {
+		return RegionRoute{}, fmt.Errorf("%w: %w", ErrNoRegionRoute, err)
+	}
+	return rr.Route(region)
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseComplianceRegion(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]ComplianceRegion{
+		"":     ComplianceRegionNone,
+		"none": ComplianceRegionNone,
+		"us":   ComplianceRegionUS,
+		"EU":   ComplianceRegionEU,
+		"apac": ComplianceRegionUnknown,
+	} {
+		if got := parseComplianceRegion(s); got != want {
+			t.Errorf("parseComplianceRegion(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestRegionRouter(t *testing.T) {
+	t.Parallel()
+
+	global := RegionRoute{Backend: "origin", KVStore: "sessions", LogEndpoint: "logs"}
+	eu := RegionRoute{Backend: "origin-eu", KVStore: "sessions-eu", LogEndpoint: "logs-eu"}
+	routes := map[ComplianceRegion]RegionRoute{ComplianceRegionNone: global}
+	euRoutes := map[ComplianceRegion]RegionRoute{ComplianceRegionNone: global, ComplianceRegionEU: eu}
+
+	for _, tt := range []struct {
+		name     string
+		routes   map[ComplianceRegion]RegionRoute
+		fallback RegionFallback
+		region   ComplianceRegion
+		want     RegionRoute
+		wantErr  bool
+	}{
+		{"none", routes, RegionFallbackDeny, ComplianceRegionNone, global, false},
+		{"eu route", euRoutes, RegionFallbackDeny, ComplianceRegionEU, eu, false},
+		{"deny", routes, RegionFallbackDeny, ComplianceRegionUS, RegionRoute{}, true},
+		{"global", routes, RegionFallbackGlobal, ComplianceRegionEU, global, false},
+		{"global without route", nil, RegionFallbackGlobal, ComplianceRegionUS, RegionRoute{}, true},
+		{"except eu for us", routes, RegionFallbackGlobalExceptEU, ComplianceRegionUS, global, false},
+		{"except eu for unknown", routes, RegionFallbackGlobalExceptEU, ComplianceRegionUnknown, global, false},
+		{"except eu for eu", routes, RegionFallbackGlobalExceptEU, ComplianceRegionEU, RegionRoute{}, true},
+	} {
+		rr := &RegionRouter{Routes: tt.routes, Fallback: tt.fallback}
+		got, err := rr.Route(tt.region)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Route(%v) = %+v, %v", tt.name, tt.region, got, err)
+		}
+		if err != nil && !errors.Is(err, ErrNoRegionRoute) {
+			t.Errorf("%s: Route error %v is not ErrNoRegionRoute", tt.name, err)
+		}
+	}
+}
+
+func TestRouteRequestNotDownstream(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ComplianceRegion(); err == nil {
+		t.Errorf("ComplianceRegion of outgoing request succeeded")
+	}
+
+	// The region of a request which is not the client request cannot be
+	// determined, so it is not routed even with a global fallback.
+	for _, fallback := range []RegionFallback{RegionFallbackGlobal, RegionFallbackGlobalExceptEU} {
+		rr := &RegionRouter{
+			Routes:   map[ComplianceRegion]RegionRoute{ComplianceRegionNone: {Backend: "origin"}},
+			Fallback: fallback,
+		}
+		if route, err := rr.RouteRequest(r); !errors.Is(err, ErrNoRegionRoute) {
+			t.Errorf("fallback %d: RouteRequest = %+v, %v; want ErrNoRegionRoute", fallback, route, err)
+		}
+	}
+}
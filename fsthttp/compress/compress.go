@@ -0,0 +1,368 @@
+// Copyright 2022 Fastly, Inc.
+
+// Package compress provides a middleware which compresses responses
+// according to the client's Accept-Encoding header.
+//
+// Responses are compressed with gzip or deflate using the standard library.
+// Other encodings, such as brotli and zstd, can be added by providing an
+// [Encoder] for them.
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// An Encoder returns a writer which compresses the data written to it, and
+// writes the result to w. Closing the returned writer must flush any
+// buffered data to w, without closing w.
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+// Options control the compression middleware.
+type Options struct {
+	// Level is the compression level for gzip and deflate, as defined in
+	// package compress/flate. If zero, flate.DefaultCompression is used.
+	Level int
+
+	// Encoders are encoders for additional content codings, such as "br"
+	// or "zstd", keyed by the name of the coding. They can also replace
+	// the built-in encoders for "gzip" and "deflate".
+	Encoders map[string]Encoder
+
+	// Preference lists content codings in the order in which they are
+	// preferred when the client accepts more than one equally. If nil,
+	// "zstd", "br", "gzip" and "deflate" are preferred in that order.
+	// Codings without an encoder are ignored.
+	Preference []string
+
+	// MinLength is the minimum Content-Length of a response to be
+	// compressed. Responses without a Content-Length are always
+	// compressed.
+	MinLength int
+
+	// Compressible reports whether a response with the given Content-Type
+	// should be compressed. If nil, DefaultCompressible is used.
+	Compressible func(contentType string) bool
+}
+
+var defaultPreference = []string{"zstd", "br", "gzip", "deflate"}
+
+// skippedTypes are the media types, or type prefixes ending in "/", which
+// are already compressed.
+var skippedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+}
+
+// DefaultCompressible reports whether a response with the given Content-Type
+// is worth compressing. Images, audio, video, compressed fonts and archives
+// are already compressed, except for SVG images.
+func DefaultCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, t := range skippedTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler returns a handler which calls h, compressing its responses with
+// the encoding most preferred by the client's Accept-Encoding header.
+//
+// A response is not compressed if it already has a Content-Encoding, if its
+// Content-Type is not compressible, if it has a Cache-Control no-transform
+// directive, if it is a partial response, or if it has no body. When a
+// response is compressed, its Content-Length is removed and a strong ETag is
+// made weak. When the response could have been compressed, Accept-Encoding
+// is added to its Vary header.
+//
+// If h enables manual framing mode and sets a Content-Length, the response
+// is not compressed, since the length would no longer be correct.
+//
+// A nil opts uses the default options.
+func Handler(h fsthttp.Handler, opts *Options) fsthttp.Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	level := opts.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	encoders := map[string]Encoder{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+	for name, enc := range opts.Encoders {
+		encoders[strings.ToLower(name)] = enc
+	}
+
+	preference := opts.Preference
+	if preference == nil {
+		preference = defaultPreference
+	}
+	var available []string
+	for _, name := range preference {
+		if _, ok := encoders[strings.ToLower(name)]; ok {
+			available = append(available, strings.ToLower(name))
+		}
+	}
+
+	compressible := opts.Compressible
+	if compressible == nil {
+		compressible = DefaultCompressible
+	}
+
+	return fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		coding := negotiate(r.Header.Values("Accept-Encoding"), available)
+		cw := &compressWriter{
+			ResponseWriter: w,
+			coding:         coding,
+			encoder:        encoders[coding],
+			head:           r.Method == fsthttp.MethodHead,
+			minLength:      opts.MinLength,
+			compressible:   compressible,
+		}
+		var rw fsthttp.ResponseWriter = cw
+		if _, ok := w.(fsthttp.VersionSetter); ok {
+			rw = versionCompressWriter{cw}
+		}
+		// Not deferred: after a panic, the response is left for the
+		// panic handler rather than closed as a success.
+		h.ServeHTTP(ctx, rw, r)
+		cw.Close()
+	})
+}
+
+// negotiate returns the coding in available with the highest quality in the
+// Accept-Encoding header values, or "" if the response should not be
+// compressed. Ties are broken by the order of available.
+func negotiate(acceptEncoding []string, available []string) string {
+	if len(acceptEncoding) == 0 || len(available) == 0 {
+		return ""
+	}
+
+	q := make(map[string]float64)
+	wildcard := -1.0
+	for _, v := range acceptEncoding {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			quality := 1.0
+			for _, p := range strings.Split(params, ";") {
+				k, v, ok := strings.Cut(p, "=")
+				if !ok || strings.ToLower(strings.TrimSpace(k)) != "q" {
+					continue
+				}
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil || f < 0 || f > 1 {
+					f = 0
+				}
+				quality = f
+			}
+			if name == "*" {
+				wildcard = quality
+				continue
+			}
+			q[name] = quality
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range available {
+		quality, ok := q[name]
+		if !ok {
+			if name == "gzip" {
+				// RFC 9110, section 12.5.3: x-gzip is equivalent to gzip.
+				quality, ok = q["x-gzip"]
+			}
+			if !ok && wildcard >= 0 {
+				quality, ok = wildcard, true
+			}
+		}
+		if ok && quality > bestQ {
+			best, bestQ = name, quality
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response written to it, if the response is
+// compressible.
+type compressWriter struct {
+	fsthttp.ResponseWriter
+
+	coding       string
+	encoder      Encoder
+	head         bool
+	minLength    int
+	compressible func(string) bool
+
+	manualFraming bool
+	wroteHeader   bool
+	closed        bool
+	enc           io.WriteCloser
+}
+
+func (cw *compressWriter) SetManualFramingMode(v bool) {
+	cw.manualFraming = v
+	cw.ResponseWriter.SetManualFramingMode(v)
+}
+
+// versionCompressWriter is a compressWriter for a ResponseWriter which
+// implements fsthttp.VersionSetter, so that the handler can still set the
+// version of the response.
+type versionCompressWriter struct {
+	*compressWriter
+}
+
+func (vw versionCompressWriter) SetVersion(major, minor int) {
+	vw.ResponseWriter.(fsthttp.VersionSetter).SetVersion(major, minor)
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code == fsthttp.StatusEarlyHints {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if cw.eligible(code, h) {
+		addVary(h, "Accept-Encoding")
+		if cw.coding != "" && !cw.head && !cw.framedByHandler(h) {
+			if enc, err := cw.encoder(cw.ResponseWriter); err == nil {
+				cw.enc = enc
+				h.Set("Content-Encoding", cw.coding)
+				h.Del("Content-Length")
+				if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+					h.Set("ETag", "W/"+etag)
+				}
+			}
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// eligible reports whether the response could be compressed for a client
+// which accepts compression.
+func (cw *compressWriter) eligible(code int, h fsthttp.Header) bool {
+	switch {
+	case code < 200, code == fsthttp.StatusNoContent, code == fsthttp.StatusNotModified:
+		return false
+	case code == fsthttp.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "":
+		return false
+	case headerContainsToken(h.Values("Cache-Control"), "no-transform"):
+		return false
+	case !cw.compressible(h.Get("Content-Type")):
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" && cw.minLength > 0 {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.minLength {
+			return false
+		}
+	}
+	return true
+}
+
+// framedByHandler reports whether the handler has set a Content-Length
+// which it asked to be used exactly.
+func (cw *compressWriter) framedByHandler(h fsthttp.Header) bool {
+	return cw.manualFraming && h.Get("Content-Length") != ""
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(fsthttp.StatusOK)
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Append appends other to the response. A body which must be compressed is
+// copied through the encoder, rather than appended by the host.
+func (cw *compressWriter) Append(other io.ReadCloser) error {
+	if !cw.wroteHeader {
+		cw.WriteHeader(fsthttp.StatusOK)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Append(other)
+	}
+	defer other.Close()
+	_, err := io.Copy(cw.enc, other)
+	return err
+}
+
+func (cw *compressWriter) Close() error {
+	if cw.closed {
+		return nil
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(fsthttp.StatusOK)
+	}
+	cw.closed = true
+	if cw.enc != nil {
+		if err := cw.enc.Close(); err != nil {
+			return err
+		}
+	}
+	return cw.ResponseWriter.Close()
+}
+
+// addVary adds name to the Vary header, unless it is already present.
+func addVary(h fsthttp.Header, name string) {
+	if headerContainsToken(h.Values("Vary"), name) || headerContainsToken(h.Values("Vary"), "*") {
+		return
+	}
+	h.Add("Vary", name)
+}
+
+func headerContainsToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+// Copyright 2022 Fastly, Inc.
+
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	available := []string{"br", "gzip", "deflate"}
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"br;q=0, gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0", "br"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+		{"GZIP; Q=1", "gzip"},
+	} {
+		var accept []string
+		if tt.accept != "" {
+			accept = []string{tt.accept}
+		}
+		if got := negotiate(accept, available); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello, world. ", 100)
+
+	upper := func(w io.Writer) (io.WriteCloser, error) {
+		return &upperWriter{w}, nil
+	}
+
+	for _, tt := range []struct {
+		name        string
+		accept      string
+		opts        *Options
+		handler     fsthttp.HandlerFunc
+		wantCoding  string
+		wantVary    bool
+		wantLength  string
+		wantETag    string
+		decodedBody string
+	}{
+		{
+			name:   "gzip",
+			accept: "gzip, deflate",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", "1400")
+				w.Header().Set("ETag", `"abc"`)
+				io.WriteString(w, body)
+			},
+			wantCoding: "gzip",
+			wantVary:   true,
+			wantETag:   `W/"abc"`,
+		},
+		{
+			name:   "deflate",
+			accept: "gzip;q=0.5, deflate",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				io.WriteString(w, body)
+			},
+			wantCoding: "deflate",
+			wantVary:   true,
+		},
+		{
+			name:   "pluggable",
+			accept: "br, gzip",
+			opts:   &Options{Encoders: map[string]Encoder{"br": upper}},
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				io.WriteString(w, "abc")
+			},
+			wantCoding:  "br",
+			wantVary:    true,
+			decodedBody: "ABC",
+		},
+		{
+			name:   "not accepted",
+			accept: "",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				io.WriteString(w, body)
+			},
+			wantVary: true,
+		},
+		{
+			name:   "compressed type",
+			accept: "gzip",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			name:   "already encoded",
+			accept: "gzip",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, body)
+			},
+			wantCoding: "br",
+		},
+		{
+			name:   "no-transform",
+			accept: "gzip",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.Header().Set("Cache-Control", "public, no-transform")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			name:   "too short",
+			accept: "gzip",
+			opts:   &Options{MinLength: 2000},
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.Header().Set("Content-Length", "1400")
+				io.WriteString(w, body)
+			},
+			wantLength: "1400",
+		},
+		{
+			name:   "manual framing",
+			accept: "gzip",
+			handler: func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+				w.SetManualFramingMode(true)
+				w.Header().Set("Content-Length", "1400")
+				io.WriteString(w, body)
+			},
+			wantVary:   true,
+			wantLength: "1400",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := fsttest.NewRecorder()
+			Handler(tt.handler, tt.opts).ServeHTTP(context.Background(), w, r)
+
+			if got := w.HeaderMap.Get("Content-Encoding"); got != tt.wantCoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantCoding)
+			}
+			if got := w.HeaderMap.Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("Vary = %q, want Accept-Encoding: %v", w.HeaderMap.Get("Vary"), tt.wantVary)
+			}
+			if got := w.HeaderMap.Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+			if tt.wantETag != "" {
+				if got := w.HeaderMap.Get("ETag"); got != tt.wantETag {
+					t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+				}
+			}
+
+			want := body
+			if tt.decodedBody != "" {
+				want = tt.decodedBody
+			}
+			if got := decode(t, w.HeaderMap.Get("Content-Encoding"), w.Body.Bytes()); got != want {
+				t.Errorf("decoded body = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// versionRecorder is a ResponseRecorder which implements
+// fsthttp.VersionSetter.
+type versionRecorder struct {
+	*fsttest.ResponseRecorder
+	major, minor int
+}
+
+func (v *versionRecorder) SetVersion(major, minor int) {
+	v.major, v.minor = major, minor
+}
+
+func TestHandlerVersionSetter(t *testing.T) {
+	t.Parallel()
+
+	var setter bool
+	handler := Handler(fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		var vs fsthttp.VersionSetter
+		if vs, setter = w.(fsthttp.VersionSetter); setter {
+			vs.SetVersion(2, 0)
+		}
+	}), nil)
+
+	r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.ServeHTTP(context.Background(), fsttest.NewRecorder(), r)
+	if setter {
+		t.Errorf("writer is a VersionSetter when the wrapped writer is not")
+	}
+
+	w := &versionRecorder{ResponseRecorder: fsttest.NewRecorder()}
+	handler.ServeHTTP(context.Background(), w, r)
+	if !setter {
+		t.Errorf("writer is not a VersionSetter when the wrapped writer is")
+	}
+	if w.major != 2 || w.minor != 0 {
+		t.Errorf("wrapped writer version = %d.%d, want 2.0", w.major, w.minor)
+	}
+}
+
+func decode(t *testing.T, coding string, b []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch coding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(b))
+	default:
+		return string(b)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u *upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+func (u *upperWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package compress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestHandlerPanic(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	handler := Handler(fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		panic("boom")
+	}), nil)
+
+	r, err := fsthttp.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept-Encoding", "gzip")
+	w, err := h.Serve(handler, &fsthttp.ServeOptions{RecoverPanics: true}, &fsttest.ClientRequest{Request: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != fsthttp.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, fsthttp.StatusInternalServerError)
+	}
+	if got, want := w.Body.String(), "Internal Server Error\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
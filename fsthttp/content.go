@@ -0,0 +1,764 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsthttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeContent replies to the request using the content in the provided
+// ReadSeeker. The main benefit of ServeContent over [io.Copy] is that it
+// handles Range requests properly, sets the MIME type, and handles
+// If-Match, If-Unmodified-Since, If-None-Match, If-Modified-Since, and
+// If-Range requests.
+//
+// The Seek method of content is used to find its size and to read each
+// requested range. Content which cannot seek can be served with
+// [ServeRangeReader], such as a *core.Found, or with [ServeSizedReader],
+// such as a *kvstore.Entry.
+//
+// If the response's Content-Type header is not set, ServeContent first tries
+// to deduce the type from name's file extension and, if that fails, falls
+// back to reading the first block of the content and passing it to
+// [http.DetectContentType]. The name is otherwise unused; in particular it
+// can be empty and is never sent in the response.
+//
+// If modtime is not the zero time or Unix epoch, ServeContent includes it in
+// a Last-Modified header in the response. If the request includes an
+// If-Modified-Since header, ServeContent uses modtime to decide whether the
+// content needs to be sent at all.
+//
+// If the caller has set w's ETag header formatted per RFC 9110, section
+// 8.8.3, ServeContent uses it to handle requests using If-Match,
+// If-None-Match, or If-Range.
+//
+// If an error occurs when serving the request (for example, when handling an
+// invalid range request), ServeContent responds with an error message, and
+// strips the Cache-Control, Content-Encoding, ETag, and Last-Modified headers
+// from the response.
+func ServeContent(w ResponseWriter, r *Request, name string, modtime time.Time, content io.ReadSeeker) {
+	serveContent(w, r, name, modtime, &seekerSource{rs: content})
+}
+
+// A RangeReader is content which can be read from any offset without
+// reading the content before it, such as a *Found from package
+// github.com/fastly/compute-sdk-go/cache/core.
+type RangeReader interface {
+	// Size returns the length of the content in bytes, or -1 if it is
+	// not known.
+	Size() int64
+
+	// GetRange returns a reader for the bytes from offset from to offset
+	// to, inclusive. If to is zero, the reader continues to the end of the
+	// content.
+	GetRange(from, to uint64) (io.ReadCloser, error)
+}
+
+// ServeRangeReader is like [ServeContent], but reads each requested range
+// of the content with GetRange. The Body of a *core.Found must be closed
+// before calling ServeRangeReader. If the size of the content is not
+// known, the Range header is ignored.
+func ServeRangeReader(w ResponseWriter, r *Request, name string, modtime time.Time, content RangeReader) {
+	serveContent(w, r, name, modtime, &rangeSource{rr: content})
+}
+
+// A SizedReader is content which can only be read once, from the start,
+// and which knows its length, such as a *kvstore.Entry.
+type SizedReader interface {
+	io.Reader
+
+	// Size returns the length of the content in bytes, or -1 if it is
+	// not known. It is called before the content is read.
+	Size() int64
+}
+
+// ServeSizedReader is like [ServeContent], but reads the content once.
+// Requested ranges are read by discarding the content before them, so a
+// request whose ranges are not in ascending order is answered with the
+// whole content, and the content type is not sniffed from the content. If
+// the size of the content is not known, the Range header is ignored.
+func ServeSizedReader(w ResponseWriter, r *Request, name string, modtime time.Time, content SizedReader) {
+	serveContent(w, r, name, modtime, &readerSource{r: content})
+}
+
+// contentSource is content which can be read in ranges.
+type contentSource interface {
+	// size returns the length of the content, or -1 if it is not known.
+	size() (int64, error)
+
+	// open returns a reader for length bytes starting at offset start. If
+	// length is negative, the reader continues to the end of the content.
+	open(start, length int64) (io.ReadCloser, error)
+
+	// rereadable reports whether the content can be opened more than once.
+	rereadable() bool
+
+	// canServe reports whether the ranges can be read, in order.
+	canServe(ranges []httpRange) bool
+}
+
+// errSeeker is returned by a seekerSource when the content doesn't seek
+// properly. The underlying Seeker's error text isn't included in the reply
+// so it's not sent over HTTP to end users.
+var errSeeker = errors.New("seeker can't seek")
+
+type seekerSource struct {
+	rs io.ReadSeeker
+}
+
+func (s *seekerSource) size() (int64, error) {
+	size, err := s.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, errSeeker
+	}
+	if _, err := s.rs.Seek(0, io.SeekStart); err != nil {
+		return 0, errSeeker
+	}
+	return size, nil
+}
+
+func (s *seekerSource) open(start, length int64) (io.ReadCloser, error) {
+	if _, err := s.rs.Seek(start, io.SeekStart); err != nil {
+		return nil, errSeeker
+	}
+	return limitReadCloser(io.NopCloser(s.rs), length), nil
+}
+
+func (s *seekerSource) rereadable() bool                 { return true }
+func (s *seekerSource) canServe(ranges []httpRange) bool { return true }
+
+type rangeSource struct {
+	rr RangeReader
+}
+
+func (s *rangeSource) size() (int64, error) {
+	return s.rr.Size(), nil
+}
+
+func (s *rangeSource) open(start, length int64) (io.ReadCloser, error) {
+	var to uint64
+	if length > 0 {
+		to = uint64(start + length - 1)
+	}
+	rc, err := s.rr.GetRange(uint64(start), to)
+	if err != nil {
+		return nil, err
+	}
+	// A range ending at offset zero cannot be expressed to GetRange, so
+	// the reader is always limited to the requested length.
+	return limitReadCloser(rc, length), nil
+}
+
+func (s *rangeSource) rereadable() bool                 { return true }
+func (s *rangeSource) canServe(ranges []httpRange) bool { return true }
+
+type readerSource struct {
+	r   SizedReader
+	pos int64
+}
+
+func (s *readerSource) size() (int64, error) {
+	return s.r.Size(), nil
+}
+
+func (s *readerSource) open(start, length int64) (io.ReadCloser, error) {
+	if start < s.pos {
+		return nil, errors.New("content can't be reread")
+	}
+	if _, err := io.CopyN(io.Discard, s.r, start-s.pos); err != nil {
+		return nil, err
+	}
+	s.pos = start
+	if length >= 0 {
+		s.pos += length
+	}
+	return limitReadCloser(io.NopCloser(s.r), length), nil
+}
+
+func (s *readerSource) rereadable() bool { return false }
+
+func (s *readerSource) canServe(ranges []httpRange) bool {
+	var next int64
+	for _, ra := range ranges {
+		if ra.start < next {
+			return false
+		}
+		next = ra.start + ra.length
+	}
+	return true
+}
+
+// limitReadCloser limits rc to n bytes, unless n is negative.
+func limitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, n), rc}
+}
+
+// errNoOverlap is returned by serveContent's parseRange if first-byte-pos of
+// all of the byte-range-spec values is greater than the content size.
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time, src contentSource) {
+	setLastModified(w, modtime)
+	done, rangeReq := checkPreconditions(w, r, modtime)
+	if done {
+		return
+	}
+
+	code := StatusOK
+
+	size, err := src.size()
+	if err != nil {
+		serveError(w, err.Error(), StatusInternalServerError)
+		return
+	}
+
+	// If Content-Type isn't set, use the file's extension to find it, but
+	// if the Content-Type is unset explicitly, do not sniff the type.
+	ctypes, haveType := w.Header()[CanonicalHeaderKey("Content-Type")]
+	var ctype string
+	if !haveType {
+		ctype = mime.TypeByExtension(path.Ext(name))
+		if ctype == "" && src.rereadable() {
+			// read a chunk to decide between utf-8 text and binary
+			n := int64(sniffLen)
+			if size >= 0 && size < n {
+				n = size
+			}
+			rc, err := src.open(0, n)
+			if err != nil {
+				serveError(w, err.Error(), StatusInternalServerError)
+				return
+			}
+			var buf [sniffLen]byte
+			m, _ := io.ReadFull(rc, buf[:n])
+			rc.Close()
+			ctype = http.DetectContentType(buf[:m])
+		}
+		if ctype != "" {
+			w.Header().Set("Content-Type", ctype)
+		}
+	} else if len(ctypes) > 0 {
+		ctype = ctypes[0]
+	}
+
+	if size < 0 {
+		// The size isn't known, so ranges can't be served.
+		rangeReq = ""
+	}
+
+	// handle Content-Range header.
+	sendSize := size
+	ranges, err := parseRange(rangeReq, size)
+	switch err {
+	case nil:
+	case errNoOverlap:
+		if size == 0 {
+			// Some clients add a Range header to all requests to
+			// limit the size of the response. If the file is empty,
+			// ignore the range header and respond with a 200 rather
+			// than a 416.
+			ranges = nil
+			break
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		fallthrough
+	default:
+		serveError(w, err.Error(), StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if sumRangesSize(ranges) > size || !src.canServe(ranges) {
+		// The total number of bytes in all the ranges
+		// is larger than the size of the file by
+		// itself, so this is probably an attack, or a
+		// dumb client. Ignore the range request.
+		ranges = nil
+	}
+
+	var mw *multipart.Writer
+	switch {
+	case len(ranges) == 1:
+		// RFC 9110, section 14.3:
+		// "If a single part is being transferred, the server
+		// generating the 206 response MUST generate a
+		// Content-Range header field, describing what range
+		// of the selected representation is enclosed, and a
+		// content consisting of the range.
+		// ...
+		// A server MUST NOT generate a multipart response to
+		// a request for a single range, since a client that
+		// does not request multiple parts might not support
+		// multipart responses."
+		sendSize = ranges[0].length
+		code = StatusPartialContent
+		w.Header().Set("Content-Range", ranges[0].contentRange(size))
+	case len(ranges) > 1:
+		sendSize = rangesMIMESize(ranges, ctype, size)
+		code = StatusPartialContent
+		mw = multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	}
+
+	if size >= 0 {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+
+	// Content-Length is not set if the user set Content-Encoding, since the
+	// ResponseWriter may be one which compresses the data written to it.
+	// If this is a range request, always set Content-Length.
+	if sendSize >= 0 && (len(ranges) > 0 || w.Header().Get("Content-Encoding") == "") {
+		w.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
+	}
+
+	if r.Method == MethodHead {
+		w.WriteHeader(code)
+		return
+	}
+
+	// The first range is opened before writing the header, so that a
+	// failure can still be reported to the client.
+	start, length := int64(0), size
+	if len(ranges) > 0 {
+		start, length = ranges[0].start, ranges[0].length
+	}
+	rc, err := src.open(start, length)
+	if err != nil {
+		serveError(w, err.Error(), StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(code)
+
+	if mw == nil {
+		defer rc.Close()
+		io.Copy(w, rc)
+		return
+	}
+
+	for i, ra := range ranges {
+		if i > 0 {
+			if rc, err = src.open(ra.start, ra.length); err != nil {
+				return
+			}
+		}
+		if err := writeRangePart(mw, rc, ra, ctype, size); err != nil {
+			return
+		}
+	}
+	mw.Close()
+}
+
+// writeRangePart writes the range ra, read from rc, as the next part of a
+// multipart/byteranges response, and closes rc.
+func writeRangePart(mw *multipart.Writer, rc io.ReadCloser, ra httpRange, ctype string, size int64) error {
+	defer rc.Close()
+	part, err := mw.CreatePart(ra.mimeHeader(ctype, size))
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(part, rc, ra.length)
+	return err
+}
+
+// sniffLen is the number of bytes read to detect the content type.
+const sniffLen = 512
+
+// serveError replies with an error, removing the headers which described the
+// content.
+func serveError(w ResponseWriter, text string, code int) {
+	h := w.Header()
+	for _, k := range []string{
+		"Cache-Control",
+		"Content-Encoding",
+		"Etag",
+		"Last-Modified",
+	} {
+		h.Del(k)
+	}
+	Error(w, text, code)
+}
+
+// scanETag determines if a syntactically valid ETag is present at s. If so,
+// the ETag and remaining text after consuming ETag is returned. Otherwise,
+// it returns "", "".
+func scanETag(s string) (etag string, remain string) {
+	s = textproto.TrimString(s)
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s[start:]) < 2 || s[start] != '"' {
+		return "", ""
+	}
+	// ETag is either W/"text" or "text".
+	// See RFC 9110, section 8.8.3.
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		// Character values allowed in ETags.
+		case c == 0x21 || c >= 0x23 && c <= 0x7E || c >= 0x80:
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
+
+// etagStrongMatch reports whether a and b match using strong ETag comparison.
+// Assumes a and b are valid ETags.
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && a[0] == '"'
+}
+
+// etagWeakMatch reports whether a and b match using weak ETag comparison.
+// Assumes a and b are valid ETags.
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// condResult is the result of an HTTP request precondition check.
+// See RFC 9110, section 13.
+type condResult int
+
+const (
+	condNone condResult = iota
+	condTrue
+	condFalse
+)
+
+func checkIfMatch(w ResponseWriter, r *Request) condResult {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		return condNone
+	}
+	for {
+		im = textproto.TrimString(im)
+		if len(im) == 0 {
+			break
+		}
+		if im[0] == ',' {
+			im = im[1:]
+			continue
+		}
+		if im[0] == '*' {
+			return condTrue
+		}
+		etag, remain := scanETag(im)
+		if etag == "" {
+			break
+		}
+		if etagStrongMatch(etag, w.Header().Get("Etag")) {
+			return condTrue
+		}
+		im = remain
+	}
+
+	return condFalse
+}
+
+func checkIfUnmodifiedSince(r *Request, modtime time.Time) condResult {
+	ius := r.Header.Get("If-Unmodified-Since")
+	if ius == "" || isZeroTime(modtime) {
+		return condNone
+	}
+	t, err := http.ParseTime(ius)
+	if err != nil {
+		return condNone
+	}
+
+	// The Last-Modified header truncates sub-second precision so
+	// the modtime needs to be truncated too.
+	modtime = modtime.Truncate(time.Second)
+	if ret := modtime.Compare(t); ret <= 0 {
+		return condTrue
+	}
+	return condFalse
+}
+
+func checkIfNoneMatch(w ResponseWriter, r *Request) condResult {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return condNone
+	}
+	buf := inm
+	for {
+		buf = textproto.TrimString(buf)
+		if len(buf) == 0 {
+			break
+		}
+		if buf[0] == ',' {
+			buf = buf[1:]
+			continue
+		}
+		if buf[0] == '*' {
+			return condFalse
+		}
+		etag, remain := scanETag(buf)
+		if etag == "" {
+			break
+		}
+		if etagWeakMatch(etag, w.Header().Get("Etag")) {
+			return condFalse
+		}
+		buf = remain
+	}
+	return condTrue
+}
+
+func checkIfModifiedSince(r *Request, modtime time.Time) condResult {
+	if r.Method != MethodGet && r.Method != MethodHead {
+		return condNone
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || isZeroTime(modtime) {
+		return condNone
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return condNone
+	}
+	// The Last-Modified header truncates sub-second precision so
+	// the modtime needs to be truncated too.
+	modtime = modtime.Truncate(time.Second)
+	if ret := modtime.Compare(t); ret <= 0 {
+		return condFalse
+	}
+	return condTrue
+}
+
+func checkIfRange(w ResponseWriter, r *Request, modtime time.Time) condResult {
+	if r.Method != MethodGet && r.Method != MethodHead {
+		return condNone
+	}
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return condNone
+	}
+	etag, _ := scanETag(ir)
+	if etag != "" {
+		if etagStrongMatch(etag, w.Header().Get("Etag")) {
+			return condTrue
+		}
+		return condFalse
+	}
+	// The If-Range value is typically the ETag value, but it may also be
+	// the modtime date. See golang.org/issue/8367.
+	if modtime.IsZero() {
+		return condFalse
+	}
+	t, err := http.ParseTime(ir)
+	if err != nil {
+		return condFalse
+	}
+	if t.Unix() == modtime.Unix() {
+		return condTrue
+	}
+	return condFalse
+}
+
+var unixEpochTime = time.Unix(0, 0)
+
+// isZeroTime reports whether t is obviously unspecified (either zero or Unix()=0).
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(unixEpochTime)
+}
+
+func setLastModified(w ResponseWriter, modtime time.Time) {
+	if !isZeroTime(modtime) {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(TimeFormat))
+	}
+}
+
+func writeNotModified(w ResponseWriter) {
+	// RFC 9110, section 15.4.5:
+	// a sender SHOULD NOT generate representation metadata other than the
+	// above listed fields unless said metadata exists for the purpose of
+	// guiding cache updates (e.g., Last-Modified might be useful if the
+	// response does not have an ETag field).
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	if h.Get("Etag") != "" {
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(StatusNotModified)
+}
+
+// checkPreconditions evaluates request preconditions and reports whether a precondition
+// resulted in sending StatusNotModified or StatusPreconditionFailed.
+func checkPreconditions(w ResponseWriter, r *Request, modtime time.Time) (done bool, rangeHeader string) {
+	// This function carefully follows RFC 9110, section 13.2.2.
+	ch := checkIfMatch(w, r)
+	if ch == condNone {
+		ch = checkIfUnmodifiedSince(r, modtime)
+	}
+	if ch == condFalse {
+		w.WriteHeader(StatusPreconditionFailed)
+		return true, ""
+	}
+	switch checkIfNoneMatch(w, r) {
+	case condFalse:
+		if r.Method == MethodGet || r.Method == MethodHead {
+			writeNotModified(w)
+			return true, ""
+		}
+		w.WriteHeader(StatusPreconditionFailed)
+		return true, ""
+	case condNone:
+		if checkIfModifiedSince(r, modtime) == condFalse {
+			writeNotModified(w)
+			return true, ""
+		}
+	}
+
+	rangeHeader = r.Header.Get("Range")
+	if rangeHeader != "" && checkIfRange(w, r, modtime) == condFalse {
+		rangeHeader = ""
+	}
+	return false, rangeHeader
+}
+
+// httpRange specifies the byte range to be sent to the client.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+	}
+	if contentType != "" {
+		h["Content-Type"] = []string{contentType}
+	}
+	return h
+}
+
+// parseRange parses a Range header string as per RFC 9110, section 14.2.
+// errNoOverlap is returned if none of the ranges overlap.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	if s == "" {
+		return nil, nil // header not present
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errors.New("invalid range")
+	}
+	var ranges []httpRange
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		start, end = textproto.TrimString(start), textproto.TrimString(end)
+		var r httpRange
+		if start == "" {
+			// If no start is specified, end specifies the
+			// range start relative to the end of the file,
+			// and we are dealing with <suffix-length>
+			// which has to be a non-negative integer as per
+			// RFC 9110, section 14.1.2.
+			if end == "" || end[0] == '-' {
+				return nil, errors.New("invalid range")
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errors.New("invalid range")
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				// If the range begins after the size of the content,
+				// then it does not overlap.
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// If no end is specified, range extends to end of the file.
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errors.New("invalid range")
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		// The specified ranges did not overlap with the content.
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// countingWriter counts how many bytes have been written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// rangesMIMESize returns the number of bytes it takes to encode the
+// provided ranges as a multipart response.
+func rangesMIMESize(ranges []httpRange, contentType string, contentSize int64) (encSize int64) {
+	var w countingWriter
+	mw := multipart.NewWriter(&w)
+	for _, ra := range ranges {
+		mw.CreatePart(ra.mimeHeader(contentType, contentSize))
+		encSize += ra.length
+	}
+	mw.Close()
+	encSize += int64(w)
+	return
+}
+
+func sumRangesSize(ranges []httpRange) (size int64) {
+	for _, ra := range ranges {
+		size += ra.length
+	}
+	return
+}
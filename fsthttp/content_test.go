@@ -0,0 +1,358 @@
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+const serveContentBody = "0123456789abcdefghij"
+
+var serveContentModtime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// rangeContent is a fsthttp.RangeReader over a string.
+type rangeContent string
+
+func (c rangeContent) Size() int64 { return int64(len(c)) }
+
+func (c rangeContent) GetRange(from, to uint64) (io.ReadCloser, error) {
+	if to == 0 {
+		to = uint64(len(c)) - 1
+	}
+	return io.NopCloser(strings.NewReader(string(c[from : to+1]))), nil
+}
+
+// streamContent is a reader over a string which can only be read once.
+type streamContent struct {
+	io.Reader
+	size int64
+}
+
+func (c *streamContent) Size() int64 { return c.size }
+
+// serveFunc serves content with one of the ServeContent functions.
+type serveFunc func(w fsthttp.ResponseWriter, r *fsthttp.Request, name string, modtime time.Time)
+
+func serveSeeker(w fsthttp.ResponseWriter, r *fsthttp.Request, name string, modtime time.Time) {
+	fsthttp.ServeContent(w, r, name, modtime, strings.NewReader(serveContentBody))
+}
+
+func serveRange(w fsthttp.ResponseWriter, r *fsthttp.Request, name string, modtime time.Time) {
+	fsthttp.ServeRangeReader(w, r, name, modtime, rangeContent(serveContentBody))
+}
+
+func serveStream(w fsthttp.ResponseWriter, r *fsthttp.Request, name string, modtime time.Time) {
+	fsthttp.ServeSizedReader(w, r, name, modtime, &streamContent{strings.NewReader(serveContentBody), int64(len(serveContentBody))})
+}
+
+// countingContent is a fsthttp.RangeReader which records how many times
+// each reader it returns is closed.
+type countingContent struct {
+	rangeContent
+	closes []int
+}
+
+func (c *countingContent) GetRange(from, to uint64) (io.ReadCloser, error) {
+	rc, err := c.rangeContent.GetRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	c.closes = append(c.closes, 0)
+	return &countingCloser{rc, &c.closes[len(c.closes)-1]}, nil
+}
+
+type countingCloser struct {
+	io.Reader
+	closes *int
+}
+
+func (c *countingCloser) Close() error {
+	*c.closes++
+	return nil
+}
+
+func TestServeContent(t *testing.T) {
+	t.Parallel()
+
+	contents := map[string]serveFunc{
+		"seeker": serveSeeker,
+		"range":  serveRange,
+		"stream": serveStream,
+	}
+
+	for _, tt := range []struct {
+		name         string
+		method       string
+		header       map[string]string
+		wantCode     int
+		wantBody     string
+		wantRange    string
+		wantLength   string
+		wantNoRanges bool // for content which can only be read once
+	}{
+		{
+			name:       "whole",
+			wantCode:   fsthttp.StatusOK,
+			wantBody:   serveContentBody,
+			wantLength: "20",
+		},
+		{
+			name:       "head",
+			method:     fsthttp.MethodHead,
+			wantCode:   fsthttp.StatusOK,
+			wantLength: "20",
+		},
+		{
+			name:       "single range",
+			header:     map[string]string{"Range": "bytes=2-5"},
+			wantCode:   fsthttp.StatusPartialContent,
+			wantBody:   "2345",
+			wantRange:  "bytes 2-5/20",
+			wantLength: "4",
+		},
+		{
+			name:       "first byte",
+			header:     map[string]string{"Range": "bytes=0-0"},
+			wantCode:   fsthttp.StatusPartialContent,
+			wantBody:   "0",
+			wantRange:  "bytes 0-0/20",
+			wantLength: "1",
+		},
+		{
+			name:       "suffix range",
+			header:     map[string]string{"Range": "bytes=-3"},
+			wantCode:   fsthttp.StatusPartialContent,
+			wantBody:   "hij",
+			wantRange:  "bytes 17-19/20",
+			wantLength: "3",
+		},
+		{
+			name:      "unsatisfiable",
+			header:    map[string]string{"Range": "bytes=30-40"},
+			wantCode:  fsthttp.StatusRequestedRangeNotSatisfiable,
+			wantBody:  "invalid range: failed to overlap\n",
+			wantRange: "bytes */20",
+		},
+		{
+			name:     "not modified",
+			header:   map[string]string{"If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT"},
+			wantCode: fsthttp.StatusNotModified,
+		},
+		{
+			name:       "modified",
+			header:     map[string]string{"If-Modified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"},
+			wantCode:   fsthttp.StatusOK,
+			wantBody:   serveContentBody,
+			wantLength: "20",
+		},
+		{
+			name:     "etag match",
+			header:   map[string]string{"If-None-Match": `"other", "v1"`},
+			wantCode: fsthttp.StatusNotModified,
+		},
+		{
+			name:       "if-range etag match",
+			header:     map[string]string{"Range": "bytes=10-", "If-Range": `"v1"`},
+			wantCode:   fsthttp.StatusPartialContent,
+			wantBody:   "abcdefghij",
+			wantRange:  "bytes 10-19/20",
+			wantLength: "10",
+		},
+		{
+			name:       "if-range etag mismatch",
+			header:     map[string]string{"Range": "bytes=10-", "If-Range": `"v0"`},
+			wantCode:   fsthttp.StatusOK,
+			wantBody:   serveContentBody,
+			wantLength: "20",
+		},
+		{
+			name:       "if-range date mismatch",
+			header:     map[string]string{"Range": "bytes=10-", "If-Range": "Mon, 01 Jan 2024 00:00:00 GMT"},
+			wantCode:   fsthttp.StatusOK,
+			wantBody:   serveContentBody,
+			wantLength: "20",
+		},
+		{
+			name:     "if-match mismatch",
+			header:   map[string]string{"If-Match": `"v0"`},
+			wantCode: fsthttp.StatusPreconditionFailed,
+		},
+		{
+			name:         "unordered ranges",
+			header:       map[string]string{"Range": "bytes=10-11,0-1"},
+			wantCode:     fsthttp.StatusPartialContent,
+			wantNoRanges: true,
+		},
+	} {
+		for kind, serve := range contents {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				t.Parallel()
+
+				method := tt.method
+				if method == "" {
+					method = fsthttp.MethodGet
+				}
+				r, err := fsthttp.NewRequest(method, "https://example.com/file.txt", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range tt.header {
+					r.Header.Set(k, v)
+				}
+
+				w := fsttest.NewRecorder()
+				w.Header().Set("ETag", `"v1"`)
+				serve(w, r, "file.txt", serveContentModtime)
+
+				wantCode := tt.wantCode
+				if tt.wantNoRanges && kind == "stream" {
+					wantCode = fsthttp.StatusOK
+				}
+				if w.Code != wantCode {
+					t.Fatalf("code = %d, want %d", w.Code, wantCode)
+				}
+				if tt.wantNoRanges {
+					return
+				}
+				if got := w.Body.String(); got != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+				if got := w.HeaderMap.Get("Content-Range"); got != tt.wantRange {
+					t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+				}
+				if got := w.HeaderMap.Get("Content-Length"); got != tt.wantLength {
+					t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+				}
+				if tt.wantCode == fsthttp.StatusOK || tt.wantCode == fsthttp.StatusPartialContent {
+					if got, want := w.HeaderMap.Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+						t.Errorf("Content-Type = %q, want %q", got, want)
+					}
+					if got, want := w.HeaderMap.Get("Last-Modified"), "Tue, 02 Jan 2024 03:04:05 GMT"; got != want {
+						t.Errorf("Last-Modified = %q, want %q", got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestServeContentMultipleRanges(t *testing.T) {
+	t.Parallel()
+
+	for kind, serve := range map[string]serveFunc{
+		"seeker": serveSeeker,
+		"range":  serveRange,
+		"stream": serveStream,
+	} {
+		t.Run(kind, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Range", "bytes=0-1, 5-7, 18-")
+
+			w := fsttest.NewRecorder()
+			serve(w, r, "data.bin", time.Time{})
+
+			if w.Code != fsthttp.StatusPartialContent {
+				t.Fatalf("code = %d, want %d", w.Code, fsthttp.StatusPartialContent)
+			}
+			if got, want := w.HeaderMap.Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+				t.Errorf("Content-Length = %q, want %q", got, want)
+			}
+			mediaType, params, err := mime.ParseMediaType(w.HeaderMap.Get("Content-Type"))
+			if err != nil || mediaType != "multipart/byteranges" {
+				t.Fatalf("Content-Type = %q, want multipart/byteranges", w.HeaderMap.Get("Content-Type"))
+			}
+
+			mr := multipart.NewReader(w.Body, params["boundary"])
+			for _, want := range []struct{ body, contentRange string }{
+				{"01", "bytes 0-1/20"},
+				{"567", "bytes 5-7/20"},
+				{"ij", "bytes 18-19/20"},
+			} {
+				part, err := mr.NextPart()
+				if err != nil {
+					t.Fatalf("NextPart: %v", err)
+				}
+				body, _ := io.ReadAll(part)
+				if string(body) != want.body {
+					t.Errorf("part body = %q, want %q", body, want.body)
+				}
+				if got := part.Header.Get("Content-Range"); got != want.contentRange {
+					t.Errorf("part Content-Range = %q, want %q", got, want.contentRange)
+				}
+			}
+			if _, err := mr.NextPart(); err != io.EOF {
+				t.Errorf("NextPart after last part = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestServeContentUnknownSize(t *testing.T) {
+	t.Parallel()
+
+	r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Range", "bytes=2-5")
+
+	w := fsttest.NewRecorder()
+	fsthttp.ServeSizedReader(w, r, "", time.Time{}, &streamContent{strings.NewReader(serveContentBody), -1})
+
+	if w.Code != fsthttp.StatusOK {
+		t.Errorf("code = %d, want %d", w.Code, fsthttp.StatusOK)
+	}
+	if got := w.Body.String(); got != serveContentBody {
+		t.Errorf("body = %q, want %q", got, serveContentBody)
+	}
+	for _, k := range []string{"Content-Length", "Accept-Ranges", "Content-Type"} {
+		if got := w.HeaderMap.Get(k); got != "" {
+			t.Errorf("%s = %q, want none", k, got)
+		}
+	}
+}
+
+func TestServeContentClosesRanges(t *testing.T) {
+	t.Parallel()
+
+	for _, rng := range []string{"bytes=2-5", "bytes=0-1, 5-7, 18-"} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Range", rng)
+
+		content := &countingContent{rangeContent: rangeContent(serveContentBody)}
+		w := fsttest.NewRecorder()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fsthttp.ServeRangeReader(w, r, "", time.Time{}, content)
+
+		if w.Code != fsthttp.StatusPartialContent {
+			t.Fatalf("%s: code = %d, want %d", rng, w.Code, fsthttp.StatusPartialContent)
+		}
+		want := strings.Count(rng, ",") + 1
+		if len(content.closes) != want {
+			t.Errorf("%s: %d readers opened, want %d", rng, len(content.closes), want)
+		}
+		for i, n := range content.closes {
+			if n != 1 {
+				t.Errorf("%s: reader %d closed %d times, want 1", rng, i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsthttp
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tNow is the synthetic current time used as now during testing.
+var tNow = time.Date(2013, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testPSL implements PublicSuffixList with just two rules: "co.uk" and the
+// default rule "*".
+type testPSL struct{}
+
+func (testPSL) String() string { return "testPSL" }
+
+func (testPSL) PublicSuffix(d string) string {
+	if d == "co.uk" || strings.HasSuffix(d, ".co.uk") {
+		return "co.uk"
+	}
+	return d[strings.LastIndex(d, ".")+1:]
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// setCookieHeaders sets the cookies in the Set-Cookie header values on the
+// jar, for u, at time now.
+func setCookieHeaders(t *testing.T, j *CookieJar, u string, now time.Time, setCookies ...string) {
+	t.Helper()
+	h := NewHeader()
+	for _, sc := range setCookies {
+		h.Add("Set-Cookie", sc)
+	}
+	j.setCookies(mustParseURL(t, u), readSetCookies(h), now)
+}
+
+// cookieString returns the cookies the jar sends to u at time now, in the
+// form of a Cookie header.
+func cookieString(t *testing.T, j *CookieJar, u string, now time.Time) string {
+	t.Helper()
+	var s []string
+	for _, c := range j.cookies(mustParseURL(t, u), now) {
+		s = append(s, c.Name+"="+c.Value)
+	}
+	return strings.Join(s, "; ")
+}
+
+func TestCookieJar(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name       string
+		fromURL    string
+		setCookies []string
+		queries    map[string]string // URL to the expected Cookie header
+	}{
+		{
+			name:       "host cookie",
+			fromURL:    "http://www.host.test",
+			setCookies: []string{"a=1"},
+			queries: map[string]string{
+				"http://www.host.test":           "a=1",
+				"http://www.host.test/some/path": "a=1",
+				"https://www.host.test":          "a=1",
+				"http://www.host.test:1234/":     "a=1",
+				"http://WWW.HOST.TEST":           "a=1",
+				"http://sub.www.host.test":       "",
+				"http://host.test":               "",
+				"ftp://www.host.test":            "",
+			},
+		},
+		{
+			name:       "domain cookie",
+			fromURL:    "http://www.host.test",
+			setCookies: []string{"a=1; domain=host.test"},
+			queries: map[string]string{
+				"http://www.host.test":     "a=1",
+				"http://host.test":         "a=1",
+				"http://sub.www.host.test": "a=1",
+				"http://www.other.test":    "",
+			},
+		},
+		{
+			name:       "illegal domain",
+			fromURL:    "http://www.host.test",
+			setCookies: []string{"a=1; domain=other.test", "b=2; domain=ww.host.test"},
+			queries: map[string]string{
+				"http://www.host.test":  "",
+				"http://www.other.test": "",
+				"http://ww.host.test":   "",
+			},
+		},
+		{
+			name:       "path",
+			fromURL:    "http://www.host.test/dir/page",
+			setCookies: []string{"a=1", "b=2; path=/", "c=3; path=/dir/sub"},
+			queries: map[string]string{
+				"http://www.host.test/dir/sub/x": "c=3; a=1; b=2",
+				"http://www.host.test/dir":       "a=1; b=2",
+				"http://www.host.test/dirx":      "b=2",
+				"http://www.host.test/":          "b=2",
+			},
+		},
+		{
+			name:       "secure",
+			fromURL:    "https://www.host.test",
+			setCookies: []string{"a=1; secure", "b=2"},
+			queries: map[string]string{
+				"https://www.host.test": "a=1; b=2",
+				"http://www.host.test":  "b=2",
+			},
+		},
+		{
+			name:       "expiry",
+			fromURL:    "http://www.host.test",
+			setCookies: []string{"a=1; max-age=60", "b=2; max-age=-1", "c=3; expires=Mon, 31 Dec 2012 12:00:00 GMT", "d=4; expires=Fri, 1 Jan 2100 00:00:00 GMT"},
+			queries: map[string]string{
+				"http://www.host.test": "a=1; d=4",
+			},
+		},
+		{
+			name:       "IP address",
+			fromURL:    "http://192.168.0.10",
+			setCookies: []string{"a=1", "b=2; domain=192.168.0.10", "c=3; domain=.168.0.10"},
+			queries: map[string]string{
+				"http://192.168.0.10":  "a=1; b=2",
+				"http://192.168.0.100": "",
+			},
+		},
+	} {
+		j := NewCookieJar(nil)
+		setCookieHeaders(t, j, tt.fromURL, tNow, tt.setCookies...)
+		for u, want := range tt.queries {
+			if got := cookieString(t, j, u, tNow.Add(time.Second)); got != want {
+				t.Errorf("%s: cookies for %s = %q, want %q", tt.name, u, got, want)
+			}
+		}
+	}
+}
+
+func TestCookieJarUpdateAndExpire(t *testing.T) {
+	t.Parallel()
+
+	const u = "http://www.host.test"
+	j := NewCookieJar(nil)
+	setCookieHeaders(t, j, u, tNow, "a=1", "b=2; max-age=10")
+	if got, want := cookieString(t, j, u, tNow), "a=1; b=2"; got != want {
+		t.Errorf("cookies = %q, want %q", got, want)
+	}
+
+	// Replacing a cookie keeps its position.
+	setCookieHeaders(t, j, u, tNow.Add(time.Second), "a=updated")
+	if got, want := cookieString(t, j, u, tNow.Add(time.Second)), "a=updated; b=2"; got != want {
+		t.Errorf("cookies after update = %q, want %q", got, want)
+	}
+
+	if got, want := cookieString(t, j, u, tNow.Add(time.Minute)), "a=updated"; got != want {
+		t.Errorf("cookies after expiry = %q, want %q", got, want)
+	}
+
+	setCookieHeaders(t, j, u, tNow.Add(time.Minute), "a=; max-age=0")
+	if got := cookieString(t, j, u, tNow.Add(time.Minute)); got != "" {
+		t.Errorf("cookies after deletion = %q, want none", got)
+	}
+}
+
+func TestCookieJarPublicSuffixList(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		psl  PublicSuffixList
+		want string
+	}{
+		{nil, "a=1"},
+		{testPSL{}, ""},
+	} {
+		j := NewCookieJar(&CookieJarOptions{PublicSuffixList: tt.psl})
+		setCookieHeaders(t, j, "http://www.bbc.co.uk", tNow, "a=1; domain=co.uk")
+		if got := cookieString(t, j, "http://www.other.co.uk", tNow); got != tt.want {
+			t.Errorf("PublicSuffixList %v: cookies for another site = %q, want %q", tt.psl, got, tt.want)
+		}
+	}
+
+	// A public suffix may set a host cookie for itself.
+	j := NewCookieJar(&CookieJarOptions{PublicSuffixList: testPSL{}})
+	setCookieHeaders(t, j, "http://co.uk", tNow, "a=1; domain=co.uk")
+	if got := cookieString(t, j, "http://co.uk", tNow); got != "a=1" {
+		t.Errorf("cookies for public suffix host = %q, want a=1", got)
+	}
+	if got := cookieString(t, j, "http://www.co.uk", tNow); got != "" {
+		t.Errorf("cookies for subdomain of public suffix = %q, want none", got)
+	}
+}
+
+func TestCookieJarJSON(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	j := NewCookieJar(nil)
+	setCookieHeaders(t, j, "https://www.host.test/", now,
+		"session=1",
+		"persistent=2; max-age=3600; domain=host.test; secure; httponly",
+		"pathed=3; path=/dir",
+	)
+	setCookieHeaders(t, j, "https://www.host.test/", now.Add(-time.Hour), "expired=4; max-age=1")
+	setCookieHeaders(t, j, "https://api.other.test/", now, "other=5")
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(b), "expired") {
+		t.Errorf("marshaled jar contains expired cookie: %s", b)
+	}
+
+	restored := NewCookieJar(nil)
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	for u, want := range map[string]string{
+		"https://www.host.test/dir/x": "pathed=3; session=1; persistent=2",
+		"http://sub.host.test/":       "",
+		"https://sub.host.test/":      "persistent=2",
+		"https://api.other.test/":     "other=5",
+	} {
+		if got := cookieString(t, restored, u, time.Now()); got != want {
+			t.Errorf("restored cookies for %s = %q, want %q", u, got, want)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"not":"a jar"}`), restored); err == nil {
+		t.Errorf("Unmarshal of malformed jar succeeded")
+	}
+}
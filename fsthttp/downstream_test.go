@@ -0,0 +1,134 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestComplianceRegionDownstream(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	router := &fsthttp.RegionRouter{
+		Routes: map[fsthttp.ComplianceRegion]fsthttp.RegionRoute{
+			fsthttp.ComplianceRegionNone: {Backend: "origin"},
+			fsthttp.ComplianceRegionEU:   {Backend: "origin-eu"},
+		},
+		Fallback: fsthttp.RegionFallbackGlobalExceptEU,
+	}
+	handler := fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		if region, err := r.ComplianceRegion(); err == nil {
+			w.Header().Set("X-Region", region.String())
+		}
+		route, err := router.RouteRequest(r)
+		switch {
+		case errors.Is(err, fsthttp.ErrNoRegionRoute):
+			w.Header().Set("X-Route", "denied")
+		case err != nil:
+			w.Header().Set("X-Route", err.Error())
+		default:
+			w.Header().Set("X-Route", route.Backend)
+		}
+	})
+
+	for _, tt := range []struct {
+		name       string
+		region     fsthttp.ComplianceRegion
+		fail       bool
+		wantRegion string
+		wantRoute  string
+	}{
+		{"none", fsthttp.ComplianceRegionNone, false, "none", "origin"},
+		{"eu", fsthttp.ComplianceRegionEU, false, "eu", "origin-eu"},
+		{"us", fsthttp.ComplianceRegionUS, false, "us", "origin"},
+		{"lookup failed", fsthttp.ComplianceRegionEU, true, "", "denied"},
+	} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := h.Serve(handler, nil, &fsttest.ClientRequest{Request: r, ComplianceRegion: tt.region, FailComplianceRegion: tt.fail})
+		if err != nil {
+			t.Fatalf("%s: Serve: %v", tt.name, err)
+		}
+		if got := w.HeaderMap.Get("X-Region"); got != tt.wantRegion {
+			t.Errorf("%s: ComplianceRegion = %q, want %q", tt.name, got, tt.wantRegion)
+		}
+		if got := w.HeaderMap.Get("X-Route"); got != tt.wantRoute {
+			t.Errorf("%s: route = %q, want %q", tt.name, got, tt.wantRoute)
+		}
+	}
+}
+
+func TestOriginalHeaderNamesDownstream(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	handler := fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		// Changes made by the handler are not reflected.
+		r.Header.Set("X-Added", "1")
+
+		names, err := r.OriginalHeaderNames()
+		if err != nil {
+			fsthttp.Error(w, err.Error(), fsthttp.StatusInternalServerError)
+			return
+		}
+		n, err := r.OriginalHeaderCount()
+		if err != nil {
+			fsthttp.Error(w, err.Error(), fsthttp.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Count", strconv.Itoa(n))
+		w.Write([]byte(strings.Join(names, ",")))
+	})
+
+	for _, tt := range []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{
+			name:  "order, case and repeats",
+			names: []string{"host", "User-Agent", "accept", "Cookie", "cookie", "ACCEPT-LANGUAGE"},
+			want:  []string{"host", "User-Agent", "accept", "Cookie", "cookie", "ACCEPT-LANGUAGE"},
+		},
+		{
+			name: "from request headers",
+			want: []string{"Accept", "Cookie", "Cookie", "Host"},
+		},
+	} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept", "*/*")
+		r.Header.Add("Cookie", "a=1")
+		r.Header.Add("Cookie", "b=2")
+
+		w, err := h.Serve(handler, nil, &fsttest.ClientRequest{Request: r, HeaderNames: tt.names})
+		if err != nil {
+			t.Fatalf("%s: Serve: %v", tt.name, err)
+		}
+		if w.Code != fsthttp.StatusOK {
+			t.Fatalf("%s: code = %d: %s", tt.name, w.Code, w.Body)
+		}
+		if got := strings.Split(w.Body.String(), ","); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: OriginalHeaderNames = %q, want %q", tt.name, got, tt.want)
+		}
+		if got, want := w.HeaderMap.Get("X-Count"), strconv.Itoa(len(tt.want)); got != want {
+			t.Errorf("%s: OriginalHeaderCount = %s, want %s", tt.name, got, want)
+		}
+	}
+}
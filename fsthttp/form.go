@@ -0,0 +1,357 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsthttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/url"
+)
+
+var (
+	// ErrNotMultipart is returned by Request.MultipartReader when the
+	// request's Content-Type is not multipart/form-data.
+	ErrNotMultipart = errors.New("fsthttp: request Content-Type isn't multipart/form-data")
+
+	// ErrMissingBoundary is returned by Request.MultipartReader when the
+	// request's Content-Type does not include a "boundary" parameter.
+	ErrMissingBoundary = errors.New("fsthttp: no multipart boundary param in Content-Type")
+
+	// ErrMissingFile is returned by Request.FormFile when the provided
+	// file field name is either not present in the request or not a file
+	// field.
+	ErrMissingFile = errors.New("fsthttp: no such file")
+)
+
+const (
+	// defaultMaxMemory is the memory cap used when FormValue and FormFile
+	// parse a multipart form.
+	defaultMaxMemory = 32 << 20 // 32 MB
+
+	// defaultMaxFormSize is the largest URL-encoded form body ParseForm
+	// reads, unless the body has been limited with MaxBytesReader.
+	defaultMaxFormSize = 10 << 20 // 10 MB
+)
+
+// MaxBytesError is returned by a reader created with MaxBytesReader, and by
+// the form parsing methods of Request, when a request body is larger than
+// its limit. Handlers should respond with [StatusRequestEntityTooLarge].
+type MaxBytesError struct {
+	Limit int64
+}
+
+func (e *MaxBytesError) Error() string {
+	return fmt.Sprintf("fsthttp: request body too large (limit %d bytes)", e.Limit)
+}
+
+// MaxBytesReader is similar to io.LimitReader but is intended for limiting
+// the size of incoming request bodies. In contrast to io.LimitReader,
+// MaxBytesReader's result is a ReadCloser, returns a non-nil error of type
+// *MaxBytesError for a Read beyond the limit, and closes the underlying
+// reader when its Close method is called.
+//
+// MaxBytesReader prevents clients from accidentally or maliciously sending
+// a large request and wasting server resources:
+//
+//	r.Body = fsthttp.MaxBytesReader(r.Body, 1<<20)
+//	if err := r.ParseForm(); err != nil {
+//		var mbe *fsthttp.MaxBytesError
+//		if errors.As(err, &mbe) {
+//			fsthttp.Error(w, err.Error(), fsthttp.StatusRequestEntityTooLarge)
+//			return
+//		}
+//		...
+//	}
+func MaxBytesReader(r io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 { // Treat negative limits as equivalent to 0.
+		n = 0
+	}
+	return &maxBytesReader{r: r, i: n, n: n}
+}
+
+type maxBytesReader struct {
+	r   io.ReadCloser // underlying reader
+	i   int64         // max bytes initially, for MaxBytesError
+	n   int64         // max bytes remaining
+	err error         // sticky error
+}
+
+func (l *maxBytesReader) Read(p []byte) (n int, err error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// If they asked for a 32KB byte read but only 5 bytes are
+	// remaining, no need to read 32KB. 6 bytes will answer the
+	// question of the whether we hit the limit or go past it.
+	// 0 < len(p) < 2^63
+	if int64(len(p))-1 > l.n {
+		p = p[:l.n+1]
+	}
+	n, err = l.r.Read(p)
+
+	// Either err != nil or n > 0 or both.
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		l.err = err
+		return n, err
+	}
+
+	n = int(l.n)
+	l.n = 0
+	l.err = &MaxBytesError{l.i}
+	return n, l.err
+}
+
+func (l *maxBytesReader) Close() error {
+	return l.r.Close()
+}
+
+func copyValues(dst, src url.Values) {
+	for k, vs := range src {
+		dst[k] = append(dst[k], vs...)
+	}
+}
+
+func parsePostForm(r *Request) (vs url.Values, err error) {
+	if r.Body == nil {
+		err = errors.New("missing form body")
+		return
+	}
+	ct := r.Header.Get("Content-Type")
+	// RFC 7231, section 3.1.1.5 - empty type
+	//   MAY be treated as application/octet-stream
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	ct, _, err = mime.ParseMediaType(ct)
+	switch {
+	case ct == "application/x-www-form-urlencoded":
+		var reader io.Reader = r.Body
+		maxFormSize := int64(math.MaxInt64)
+		if _, ok := r.Body.(*maxBytesReader); !ok {
+			maxFormSize = defaultMaxFormSize
+			reader = io.LimitReader(r.Body, maxFormSize+1)
+		}
+		b, e := io.ReadAll(reader)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			break
+		}
+		if int64(len(b)) > maxFormSize {
+			err = &MaxBytesError{Limit: maxFormSize}
+			return
+		}
+		vs, e = url.ParseQuery(string(b))
+		if err == nil {
+			err = e
+		}
+	case ct == "multipart/form-data":
+		// handled by ParseMultipartForm (which is calling us, or should be)
+	}
+	return
+}
+
+// ParseForm populates r.Form and r.PostForm.
+//
+// For all requests, ParseForm parses the raw query from the URL and updates
+// r.Form.
+//
+// For POST, PUT, and PATCH requests, it also reads the request body, parses
+// it as a form and puts the results into both r.PostForm and r.Form. Request
+// body parameters take precedence over URL query string values in r.Form.
+//
+// If the request Body's size has not already been limited by
+// MaxBytesReader, the size is capped at 10MB. A larger body results in a
+// *MaxBytesError.
+//
+// For other HTTP methods, or when the Content-Type is not
+// application/x-www-form-urlencoded, the request Body is not read, and
+// r.PostForm is initialized to a non-nil, empty value.
+//
+// ParseMultipartForm calls ParseForm automatically. ParseForm is
+// idempotent.
+func (r *Request) ParseForm() error {
+	var err error
+	if r.PostForm == nil {
+		if r.Method == MethodPost || r.Method == MethodPut || r.Method == MethodPatch {
+			r.PostForm, err = parsePostForm(r)
+		}
+		if r.PostForm == nil {
+			r.PostForm = make(url.Values)
+		}
+	}
+	if r.Form == nil {
+		if len(r.PostForm) > 0 {
+			r.Form = make(url.Values)
+			copyValues(r.Form, r.PostForm)
+		}
+		var newValues url.Values
+		if r.URL != nil {
+			var e error
+			newValues, e = url.ParseQuery(r.URL.RawQuery)
+			if err == nil {
+				err = e
+			}
+		}
+		if newValues == nil {
+			newValues = make(url.Values)
+		}
+		if r.Form == nil {
+			r.Form = newValues
+		} else {
+			copyValues(r.Form, newValues)
+		}
+	}
+	return err
+}
+
+// ParseMultipartForm parses a request body as multipart/form-data. The
+// whole request body is parsed, and all of it is held in memory, since
+// Compute has no file system for larger file parts. A body larger than
+// maxMemory bytes results in a *MaxBytesError. ParseMultipartForm calls
+// ParseForm if necessary. If ParseForm returns an error,
+// ParseMultipartForm returns it but also continues parsing the request
+// body. After one call to ParseMultipartForm, subsequent calls have no
+// effect.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+
+	var parseFormErr error
+	if r.Form == nil {
+		// Let errors in ParseForm fall through, and just
+		// return it at the end.
+		parseFormErr = r.ParseForm()
+	}
+
+	boundary, err := r.multipartBoundary(false)
+	if err != nil {
+		return err
+	}
+
+	// Hold the whole form in memory, rather than spilling large file
+	// parts to temporary files, and limit the body to maxMemory instead.
+	if mbr, ok := r.Body.(*maxBytesReader); !ok || mbr.n > maxMemory {
+		r.Body = MaxBytesReader(r.Body, maxMemory)
+	}
+	f, err := multipart.NewReader(r.Body, boundary).ReadForm(math.MaxInt64)
+	if err != nil {
+		var mbe *MaxBytesError
+		if errors.As(err, &mbe) {
+			return mbe
+		}
+		return err
+	}
+
+	if r.PostForm == nil {
+		r.PostForm = make(url.Values)
+	}
+	for k, v := range f.Value {
+		r.Form[k] = append(r.Form[k], v...)
+		// r.PostForm should also be populated. See Issue 9305.
+		r.PostForm[k] = append(r.PostForm[k], v...)
+	}
+
+	r.MultipartForm = f
+
+	return parseFormErr
+}
+
+// MultipartReader returns a MIME multipart reader if this is a
+// multipart/form-data or a multipart/mixed POST request, else returns nil
+// and an error. Use this function instead of ParseMultipartForm to process
+// the request body as a stream, without holding it in memory.
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	if r.MultipartForm != nil {
+		return nil, errors.New("fsthttp: multipart handled by ParseMultipartForm")
+	}
+	return r.multipartReader(true)
+}
+
+func (r *Request) multipartReader(allowMixed bool) (*multipart.Reader, error) {
+	boundary, err := r.multipartBoundary(allowMixed)
+	if err != nil {
+		return nil, err
+	}
+	return multipart.NewReader(r.Body, boundary), nil
+}
+
+func (r *Request) multipartBoundary(allowMixed bool) (string, error) {
+	v := r.Header.Get("Content-Type")
+	if v == "" {
+		return "", ErrNotMultipart
+	}
+	if r.Body == nil {
+		return "", errors.New("missing form body")
+	}
+	d, params, err := mime.ParseMediaType(v)
+	if err != nil || !(d == "multipart/form-data" || allowMixed && d == "multipart/mixed") {
+		return "", ErrNotMultipart
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		return "", ErrMissingBoundary
+	}
+	return boundary, nil
+}
+
+// FormValue returns the first value for the named component of the query.
+// Body parameters take precedence over URL query string values.
+// FormValue calls ParseMultipartForm and ParseForm if necessary and ignores
+// any errors returned by these functions. If key is not present, FormValue
+// returns the empty string. To access multiple values of the same key, call
+// ParseForm and then inspect Request.Form directly.
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil {
+		r.ParseMultipartForm(defaultMaxMemory)
+	}
+	if vs := r.Form[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// PostFormValue returns the first value for the named component of the
+// POST, PUT, or PATCH request body. URL query parameters are ignored.
+// PostFormValue calls ParseMultipartForm and ParseForm if necessary and
+// ignores any errors returned by these functions. If key is not present,
+// PostFormValue returns the empty string.
+func (r *Request) PostFormValue(key string) string {
+	if r.PostForm == nil {
+		r.ParseMultipartForm(defaultMaxMemory)
+	}
+	if vs := r.PostForm[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// FormFile returns the first file for the provided form key. FormFile calls
+// ParseMultipartForm and ParseForm if necessary.
+func (r *Request) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
+	if r.MultipartForm == nil {
+		err := r.ParseMultipartForm(defaultMaxMemory)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if r.MultipartForm != nil && r.MultipartForm.File != nil {
+		if fhs := r.MultipartForm.File[key]; len(fhs) > 0 {
+			f, err := fhs[0].Open()
+			return f, fhs[0], err
+		}
+	}
+	return nil, nil, ErrMissingFile
+}
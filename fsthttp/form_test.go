@@ -0,0 +1,158 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestParseForm(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRequest("POST", "https://example.com/?q=query&both=url", strings.NewReader("p=post&both=body&both=body2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if err := r.ParseForm(); err != nil {
+		t.Fatalf("ParseForm: %v", err)
+	}
+	if got, want := r.Form["both"], []string{"body", "body2", "url"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf(`Form["both"] = %q, want %q`, got, want)
+	}
+	for _, tt := range []struct {
+		key, form, post string
+	}{
+		{"q", "query", ""},
+		{"p", "post", "post"},
+		{"both", "body", "body"},
+		{"missing", "", ""},
+	} {
+		if got := r.FormValue(tt.key); got != tt.form {
+			t.Errorf("FormValue(%q) = %q, want %q", tt.key, got, tt.form)
+		}
+		if got := r.PostFormValue(tt.key); got != tt.post {
+			t.Errorf("PostFormValue(%q) = %q, want %q", tt.key, got, tt.post)
+		}
+	}
+}
+
+func TestParseFormMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRequest("POST", "https://example.com/", strings.NewReader("p="+strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Body = MaxBytesReader(r.Body, 10)
+
+	var mbe *MaxBytesError
+	if err := r.ParseForm(); !errors.As(err, &mbe) || mbe.Limit != 10 {
+		t.Errorf("ParseForm error = %v, want MaxBytesError with limit 10", err)
+	}
+}
+
+func newMultipartRequest(t *testing.T) *Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "gopher")
+	fw, err := mw.CreateFormFile("upload", "hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("hello, world"))
+	mw.Close()
+
+	r, err := NewRequest("POST", "https://example.com/?q=query", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	t.Parallel()
+
+	r := newMultipartRequest(t)
+	if got := r.FormValue("name"); got != "gopher" {
+		t.Errorf(`FormValue("name") = %q, want "gopher"`, got)
+	}
+	if got := r.FormValue("q"); got != "query" {
+		t.Errorf(`FormValue("q") = %q, want "query"`, got)
+	}
+	if got := r.PostFormValue("name"); got != "gopher" {
+		t.Errorf(`PostFormValue("name") = %q, want "gopher"`, got)
+	}
+
+	f, fh, err := r.FormFile("upload")
+	if err != nil {
+		t.Fatalf("FormFile: %v", err)
+	}
+	defer f.Close()
+	b, _ := io.ReadAll(f)
+	if fh.Filename != "hello.txt" || string(b) != "hello, world" {
+		t.Errorf("FormFile = %q with %q, want hello.txt with %q", fh.Filename, b, "hello, world")
+	}
+	if _, _, err := r.FormFile("missing"); err != ErrMissingFile {
+		t.Errorf("FormFile(missing) error = %v, want %v", err, ErrMissingFile)
+	}
+	if _, err := r.MultipartReader(); err == nil {
+		t.Errorf("MultipartReader after ParseMultipartForm succeeded, want error")
+	}
+}
+
+func TestParseMultipartFormMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	r := newMultipartRequest(t)
+	var mbe *MaxBytesError
+	if err := r.ParseMultipartForm(64); !errors.As(err, &mbe) || mbe.Limit != 64 {
+		t.Errorf("ParseMultipartForm error = %v, want MaxBytesError with limit 64", err)
+	}
+}
+
+func TestMultipartReader(t *testing.T) {
+	t.Parallel()
+
+	r := newMultipartRequest(t)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		t.Fatalf("MultipartReader: %v", err)
+	}
+	var names []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		names = append(names, p.FormName())
+	}
+	if got, want := strings.Join(names, ","), "name,upload"; got != want {
+		t.Errorf("parts = %s, want %s", got, want)
+	}
+
+	r, err = NewRequest("POST", "https://example.com/", strings.NewReader("a=b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := r.MultipartReader(); err != ErrNotMultipart {
+		t.Errorf("MultipartReader error = %v, want %v", err, ErrNotMultipart)
+	}
+	r.Header.Set("Content-Type", "multipart/form-data")
+	if _, err := r.MultipartReader(); err != ErrMissingBoundary {
+		t.Errorf("MultipartReader error = %v, want %v", err, ErrMissingBoundary)
+	}
+}
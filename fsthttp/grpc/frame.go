@@ -0,0 +1,52 @@
+// Copyright 2022 Fastly, Inc.
+
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameHeaderLen is the length of the prefix of each message in a gRPC
+// stream: a flags byte and a 4-byte big-endian message length.
+const frameHeaderLen = 5
+
+// Flags in the first byte of a frame header.
+const (
+	flagCompressed = 1 << 0
+	flagTrailer    = 1 << 7 // gRPC-Web trailer frame
+)
+
+// defaultMaxRecvMsgSize is the default limit on the size of a received
+// message, as in grpc-go.
+const defaultMaxRecvMsgSize = 4 << 20
+
+// appendFrame appends a frame holding msg, with the given flags, to b.
+func appendFrame(b []byte, flags byte, msg []byte) []byte {
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readFrame reads a frame from r. It returns io.EOF if r ends before the
+// frame, and io.ErrUnexpectedEOF if it ends within it.
+func readFrame(r io.Reader, maxSize int) (flags byte, msg []byte, err error) {
+	var hdr [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if uint64(n) > uint64(maxSize) {
+		return 0, nil, &StatusError{Code: ResourceExhausted, Message: fmt.Sprintf("received message larger than max (%d vs. %d)", n, maxSize)}
+	}
+	msg = make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return hdr[0], msg, nil
+}
@@ -0,0 +1,361 @@
+// Copyright 2022 Fastly, Inc.
+
+// Package grpc implements a gRPC client for calling services on backends
+// which use gRPC, such as dynamic backends registered with
+// [fsthttp.BackendOptions.UseGRPC].
+//
+// The client supports unary and server-streaming RPCs. Messages are
+// marshaled with a [Codec], so that the package does not depend on a
+// protocol buffer implementation. A codec for protocol buffers is a thin
+// wrapper around the marshaling functions of the protobuf package:
+//
+//	type protoCodec struct{}
+//
+//	func (protoCodec) Name() string                       { return "proto" }
+//	func (protoCodec) Marshal(v any) ([]byte, error)      { return proto.Marshal(v.(proto.Message)) }
+//	func (protoCodec) Unmarshal(data []byte, v any) error { return proto.Unmarshal(data, v.(proto.Message)) }
+//
+//	cc := grpc.NewClientConn("greeter", &grpc.ClientOptions{Codec: protoCodec{}})
+//	var reply pb.HelloReply
+//	err := cc.Invoke(ctx, "/helloworld.Greeter/SayHello", &pb.HelloRequest{Name: "gopher"}, &reply)
+//
+// Errors returned by RPCs are *StatusError values carrying the gRPC status
+// code and message sent by the server.
+//
+// The package also provides [WebProxy], a handler which translates gRPC-Web
+// requests from browsers into gRPC requests to a backend.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// Codec marshals and unmarshals messages.
+type Codec interface {
+	// Name returns the name of the codec, which is used as the
+	// content-subtype of requests, such as "proto" for
+	// application/grpc+proto.
+	Name() string
+
+	// Marshal returns the encoding of v.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes data into v.
+	Unmarshal(data []byte, v any) error
+}
+
+// BytesCodec is a Codec which sends and receives messages which have
+// already been marshaled. It marshals a []byte, and unmarshals into a
+// *[]byte. Its name is "proto", so it can be used with protocol buffer
+// messages marshaled elsewhere.
+type BytesCodec struct{}
+
+// Name implements Codec.
+func (BytesCodec) Name() string { return "proto" }
+
+// Marshal implements Codec.
+func (BytesCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("grpc: BytesCodec cannot marshal %T", v)
+	}
+	return b, nil
+}
+
+// Unmarshal implements Codec.
+func (BytesCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("grpc: BytesCodec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// ClientOptions control a ClientConn.
+type ClientOptions struct {
+	// Codec marshals and unmarshals messages. If nil, BytesCodec is used.
+	Codec Codec
+
+	// Authority is the host sent in the URL of requests. If empty, the
+	// name of the backend is used.
+	Authority string
+
+	// Insecure sends requests with the http scheme rather than https.
+	Insecure bool
+
+	// MaxRecvMsgSize is the largest message, in bytes, which may be
+	// received. If zero, the limit is 4 MiB.
+	MaxRecvMsgSize int
+}
+
+// ClientConn makes RPCs to a backend. It may be used by multiple
+// goroutines.
+type ClientConn struct {
+	backend string
+	opts    ClientOptions
+}
+
+// NewClientConn returns a ClientConn which sends RPCs to the named backend.
+// A nil opts uses the default options.
+func NewClientConn(backend string, opts *ClientOptions) *ClientConn {
+	cc := &ClientConn{backend: backend}
+	if opts != nil {
+		cc.opts = *opts
+	}
+	if cc.opts.Codec == nil {
+		cc.opts.Codec = BytesCodec{}
+	}
+	if cc.opts.Authority == "" {
+		cc.opts.Authority = backend
+	}
+	if cc.opts.MaxRecvMsgSize <= 0 {
+		cc.opts.MaxRecvMsgSize = defaultMaxRecvMsgSize
+	}
+	return cc
+}
+
+// CallOption configures a single RPC.
+type CallOption func(*callInfo)
+
+type callInfo struct {
+	header fsthttp.Header
+}
+
+// WithMetadata adds a metadata entry, which is sent as a request header,
+// to the RPC. Keys ending in "-bin" have binary values, which are base64
+// encoded by the caller.
+func WithMetadata(key, value string) CallOption {
+	return func(ci *callInfo) {
+		ci.header.Add(key, value)
+	}
+}
+
+// Invoke makes a unary RPC to method, such as "/package.Service/Method",
+// sending args and unmarshaling the response into reply.
+//
+// If ctx has a deadline, it is sent to the server in the grpc-timeout
+// header. If the RPC completes with a status other than OK, Invoke returns
+// a *StatusError.
+func (cc *ClientConn) Invoke(ctx context.Context, method string, args, reply any, opts ...CallOption) error {
+	s, err := cc.NewStream(ctx, method, args, opts...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.RecvMsg(reply); err != nil {
+		if err == io.EOF {
+			return &StatusError{Code: Internal, Message: "no response message"}
+		}
+		return err
+	}
+	if err := s.RecvMsg(new(discard)); err != io.EOF {
+		if err == nil {
+			return &StatusError{Code: Internal, Message: "more than one response message for unary RPC"}
+		}
+		return err
+	}
+	return nil
+}
+
+// discard is a message which RecvMsg can unmarshal into without a codec.
+type discard struct{}
+
+// NewStream makes a server-streaming RPC to method, such as
+// "/package.Service/Method", sending args. The response messages are read
+// with the returned Stream's RecvMsg method.
+//
+// If ctx has a deadline, it is sent to the server in the grpc-timeout
+// header. If the server responds with a status other than OK before
+// sending any messages, NewStream returns a *StatusError.
+func (cc *ClientConn) NewStream(ctx context.Context, method string, args any, opts ...CallOption) (*Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, statusFromError(err)
+	}
+
+	msg, err := cc.opts.Codec.Marshal(args)
+	if err != nil {
+		return nil, &StatusError{Code: Internal, Message: fmt.Sprintf("marshal request: %v", err)}
+	}
+
+	scheme := "https"
+	if cc.opts.Insecure {
+		scheme = "http"
+	}
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+	req, err := fsthttp.NewRequest(fsthttp.MethodPost, scheme+"://"+cc.opts.Authority+method, bytes.NewReader(appendFrame(nil, 0, msg)))
+	if err != nil {
+		return nil, &StatusError{Code: Internal, Message: err.Error()}
+	}
+	req.CacheOptions.Pass = true
+
+	ci := callInfo{header: req.Header}
+	for _, opt := range opts {
+		opt(&ci)
+	}
+	req.Header.Set("Content-Type", contentType(cc.opts.Codec.Name()))
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", encodeTimeout(time.Until(deadline)))
+	}
+
+	resp, err := req.Send(ctx, cc.backend)
+	if err != nil {
+		return nil, statusFromError(err)
+	}
+
+	if resp.StatusCode != fsthttp.StatusOK {
+		resp.Body.Close()
+		return nil, statusFromHTTP(resp.StatusCode)
+	}
+	// A trailers-only response carries its status in the headers.
+	if st, ok := statusFromHeader(resp.Header); ok {
+		resp.Body.Close()
+		if st != nil {
+			return nil, st
+		}
+		return &Stream{ctx: ctx, resp: resp, codec: cc.opts.Codec, done: true}, nil
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc") {
+		resp.Body.Close()
+		return nil, &StatusError{Code: Unknown, Message: fmt.Sprintf("unexpected content type %q", ct)}
+	}
+
+	return &Stream{ctx: ctx, resp: resp, codec: cc.opts.Codec, maxSize: cc.opts.MaxRecvMsgSize}, nil
+}
+
+// Stream is the response to an RPC.
+type Stream struct {
+	ctx     context.Context
+	resp    *fsthttp.Response
+	codec   Codec
+	maxSize int
+
+	done    bool
+	err     error
+	trailer fsthttp.Header
+}
+
+// Header returns the header metadata sent by the server.
+func (s *Stream) Header() fsthttp.Header {
+	return s.resp.Header
+}
+
+// Trailer returns the trailer metadata sent by the server. It is only
+// available once RecvMsg has returned an error, including io.EOF.
+func (s *Stream) Trailer() fsthttp.Header {
+	return s.trailer
+}
+
+// RecvMsg receives the next response message into m. It returns io.EOF
+// once the server has sent every message and completed the RPC with a
+// status of OK, or a *StatusError if the RPC failed.
+func (s *Stream) RecvMsg(m any) error {
+	if s.done {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+	if err := s.ctx.Err(); err != nil {
+		return s.fail(statusFromError(err))
+	}
+
+	flags, msg, err := readFrame(s.resp.Body, s.maxSize)
+	switch {
+	case err == io.EOF:
+		return s.finish()
+	case err != nil:
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return s.fail(statusFromError(err))
+	case flags&flagCompressed != 0:
+		return s.fail(&StatusError{Code: Internal, Message: "compressed messages are not supported"})
+	}
+
+	if _, ok := m.(*discard); ok {
+		return nil
+	}
+	if err := s.codec.Unmarshal(msg, m); err != nil {
+		return s.fail(&StatusError{Code: Internal, Message: fmt.Sprintf("unmarshal response: %v", err)})
+	}
+	return nil
+}
+
+// Close abandons the rest of the response.
+func (s *Stream) Close() error {
+	if !s.done {
+		s.done = true
+		s.err = &StatusError{Code: Canceled, Message: "stream closed"}
+	}
+	return s.resp.Body.Close()
+}
+
+// finish reads the status from the trailers at the end of the response.
+func (s *Stream) finish() error {
+	trailer, err := s.resp.Trailers()
+	if err != nil {
+		return s.fail(&StatusError{Code: Internal, Message: fmt.Sprintf("read trailers: %v", err)})
+	}
+	s.trailer = trailer
+	st, ok := statusFromHeader(trailer)
+	if !ok {
+		return s.fail(&StatusError{Code: Internal, Message: "server closed the stream without sending trailers"})
+	}
+	if st != nil {
+		return s.fail(st)
+	}
+	s.done = true
+	s.resp.Body.Close()
+	return io.EOF
+}
+
+func (s *Stream) fail(err error) error {
+	s.done = true
+	s.err = err
+	s.resp.Body.Close()
+	return err
+}
+
+func contentType(subtype string) string {
+	if subtype == "" {
+		return "application/grpc"
+	}
+	return "application/grpc+" + subtype
+}
+
+// encodeTimeout encodes d for the grpc-timeout header, which allows at most
+// 8 digits, in the smallest unit which can represent it, rounding up.
+func encodeTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	const maxValue = 1e8 - 1
+	for _, u := range []struct {
+		d    time.Duration
+		unit string
+	}{
+		{time.Nanosecond, "n"},
+		{time.Microsecond, "u"},
+		{time.Millisecond, "m"},
+		{time.Second, "S"},
+		{time.Minute, "M"},
+	} {
+		if n := (d + u.d - 1) / u.d; n <= maxValue {
+			return strconv.FormatInt(int64(n), 10) + u.unit
+		}
+	}
+	return strconv.FormatInt(int64(min((d+time.Hour-1)/time.Hour, maxValue)), 10) + "H"
+}
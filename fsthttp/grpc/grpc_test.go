@@ -0,0 +1,226 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+// echoServer is a gRPC server which replies to each request message with
+// the message repeated the number of times given by the "n" metadata, and
+// then with the status given by the "status" metadata.
+func echoServer(t *testing.T, got *fsthttp.Request) fsthttp.Handler {
+	return fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		*got = *r
+		_, msg, err := readFrame(r.Body, defaultMaxRecvMsgSize)
+		if err != nil {
+			t.Errorf("server: read request: %v", err)
+		}
+		n, _ := strconv.Atoi(r.Header.Get("N"))
+		if n == 0 {
+			n = 1
+		}
+		code := r.Header.Get("Status")
+		if code == "" {
+			code = "0"
+		}
+
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(fsthttp.StatusOK)
+		for i := 0; i < n; i++ {
+			w.Write(appendFrame(nil, 0, msg))
+		}
+		w.Header().Set("Grpc-Status", code)
+		if code != "0" {
+			w.Header().Set("Grpc-Message", encodeMessage("failed: 100% ✗"))
+		}
+	})
+}
+
+func TestInvoke(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	var got fsthttp.Request
+	h.AddBackend("greeter", echoServer(t, &got))
+
+	cc := NewClientConn("greeter", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var reply []byte
+	if err := cc.Invoke(ctx, "/helloworld.Greeter/SayHello", []byte("hello"), &reply, WithMetadata("X-Trace", "abc")); err != nil {
+		t.Fatalf("Invoke: %v", err)
+	}
+	if string(reply) != "hello" {
+		t.Errorf("reply = %q, want %q", reply, "hello")
+	}
+
+	if got.Method != "POST" || got.URL.Path != "/helloworld.Greeter/SayHello" || got.URL.Host != "greeter" {
+		t.Errorf("request = %s %s, want POST https://greeter/helloworld.Greeter/SayHello", got.Method, got.URL)
+	}
+	for k, want := range map[string]string{
+		"Content-Type": "application/grpc+proto",
+		"TE":           "trailers",
+		"X-Trace":      "abc",
+	} {
+		if v := got.Header.Get(k); v != want {
+			t.Errorf("request header %s = %q, want %q", k, v, want)
+		}
+	}
+	if v := got.Header.Get("Grpc-Timeout"); v == "" {
+		t.Errorf("grpc-timeout not sent")
+	} else if n, err := strconv.Atoi(v[:len(v)-1]); err != nil || v[len(v)-1] != 'u' || n <= 59e6 || n > 60e6 {
+		t.Errorf("grpc-timeout = %q, want about 1m", v)
+	}
+
+	err := cc.Invoke(ctx, "/helloworld.Greeter/SayHello", []byte("hello"), &reply, WithMetadata("Status", "5"))
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != NotFound || se.Message != "failed: 100% ✗" {
+		t.Errorf("Invoke error = %v, want NotFound with decoded message", err)
+	}
+	if CodeOf(err) != NotFound {
+		t.Errorf("CodeOf = %v, want %v", CodeOf(err), NotFound)
+	}
+
+	err = cc.Invoke(ctx, "/helloworld.Greeter/SayHello", []byte("hello"), &reply, WithMetadata("N", "2"))
+	if CodeOf(err) != Internal {
+		t.Errorf("Invoke with two replies error = %v, want Internal", err)
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	var got fsthttp.Request
+	h.AddBackend("greeter", echoServer(t, &got))
+
+	cc := NewClientConn("greeter", nil)
+	for _, tt := range []struct {
+		status  string
+		wantErr Code
+	}{
+		{"0", OK},
+		{"14", Unavailable},
+	} {
+		s, err := cc.NewStream(context.Background(), "helloworld.Greeter/SayHellos", []byte("hi"), WithMetadata("N", "3"), WithMetadata("Status", tt.status))
+		if err != nil {
+			t.Fatalf("NewStream: %v", err)
+		}
+		var n int
+		for {
+			var m []byte
+			err = s.RecvMsg(&m)
+			if err != nil {
+				break
+			}
+			if string(m) != "hi" {
+				t.Errorf("message = %q, want %q", m, "hi")
+			}
+			n++
+		}
+		if n != 3 {
+			t.Errorf("received %d messages, want 3", n)
+		}
+		if tt.wantErr == OK && err != io.EOF {
+			t.Errorf("RecvMsg error = %v, want io.EOF", err)
+		}
+		if tt.wantErr != OK && CodeOf(err) != tt.wantErr {
+			t.Errorf("RecvMsg error = %v, want %v", err, tt.wantErr)
+		}
+		if s.Trailer().Get("Grpc-Status") != tt.status {
+			t.Errorf("trailer grpc-status = %q, want %q", s.Trailer().Get("Grpc-Status"), tt.status)
+		}
+		s.Close()
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	h.AddBackend("missing", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		fsthttp.Error(w, "not found", fsthttp.StatusNotFound)
+	}))
+	h.AddBackend("trailers-only", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "7")
+		w.Header().Set("Grpc-Message", "denied")
+	}))
+	h.AddBackend("refused", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+	h.FailBackend("refused", fsthttp.SendErrorConnectionRefused, -1)
+
+	for _, tt := range []struct {
+		backend string
+		want    Code
+	}{
+		{"missing", Unimplemented},
+		{"trailers-only", PermissionDenied},
+		{"refused", Unavailable},
+	} {
+		var reply []byte
+		err := NewClientConn(tt.backend, nil).Invoke(context.Background(), "/s/m", []byte{}, &reply)
+		if CodeOf(err) != tt.want {
+			t.Errorf("%s: Invoke error = %v, want %v", tt.backend, err, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var reply []byte
+	if err := NewClientConn("missing", nil).Invoke(ctx, "/s/m", []byte{}, &reply); CodeOf(err) != Canceled {
+		t.Errorf("Invoke with canceled context error = %v, want %v", err, Canceled)
+	}
+}
+
+func TestEncodeTimeout(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0n"},
+		{time.Nanosecond, "1n"},
+		{50 * time.Millisecond, "50000000n"},
+		{time.Second, "1000000u"},
+		{1500 * time.Millisecond, "1500000u"},
+		{time.Hour, "3600000m"},
+		{1000 * time.Hour, "3600000S"},
+	} {
+		if got := encodeTimeout(tt.d); got != tt.want {
+			t.Errorf("encodeTimeout(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestMessageEncoding(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		msg, enc string
+	}{
+		{"plain", "plain"},
+		{"100%", "100%25"},
+		{"ü\nnext", "%C3%BC%0Anext"},
+	} {
+		if got := encodeMessage(tt.msg); got != tt.enc {
+			t.Errorf("encodeMessage(%q) = %q, want %q", tt.msg, got, tt.enc)
+		}
+		if got := decodeMessage(tt.enc); got != tt.msg {
+			t.Errorf("decodeMessage(%q) = %q, want %q", tt.enc, got, tt.msg)
+		}
+	}
+	if got := decodeMessage("bad %zz and %4"); got != "bad %zz and %4" {
+		t.Errorf("decodeMessage of malformed escapes = %q", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Fastly, Inc.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// Code is a gRPC status code.
+type Code uint32
+
+// The gRPC status codes. See
+// https://grpc.github.io/grpc/core/md_doc_statuscodes.html.
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+var codeNames = [...]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+// String implements fmt.Stringer.
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// StatusError is the error returned for an RPC which completed with a status
+// other than OK.
+type StatusError struct {
+	Code    Code
+	Message string
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("grpc: code = %v desc = %s", e.Code, e.Message)
+}
+
+// Errorf returns a *StatusError with the given code and formatted message.
+func Errorf(c Code, format string, a ...any) error {
+	return &StatusError{Code: c, Message: fmt.Sprintf(format, a...)}
+}
+
+// CodeOf returns the status code of err. It returns OK for a nil error,
+// the code of a *StatusError, Canceled or DeadlineExceeded for the
+// corresponding context errors, and Unknown for any other error.
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var se *StatusError
+	switch {
+	case errors.As(err, &se):
+		return se.Code
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	}
+	return Unknown
+}
+
+// statusFromError converts an error which occurred while making a call into
+// a *StatusError.
+func statusFromError(err error) error {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se
+	}
+	var sendErr fsthttp.SendError
+	if errors.As(err, &sendErr) {
+		return &StatusError{Code: Unavailable, Message: err.Error()}
+	}
+	return &StatusError{Code: CodeOf(err), Message: err.Error()}
+}
+
+// statusFromHTTP returns the status for a response with an HTTP status code
+// other than 200, as described by
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md.
+func statusFromHTTP(code int) *StatusError {
+	var c Code
+	switch code {
+	case fsthttp.StatusBadRequest:
+		c = Internal
+	case fsthttp.StatusUnauthorized:
+		c = Unauthenticated
+	case fsthttp.StatusForbidden:
+		c = PermissionDenied
+	case fsthttp.StatusNotFound:
+		c = Unimplemented
+	case fsthttp.StatusTooManyRequests, fsthttp.StatusBadGateway, fsthttp.StatusServiceUnavailable, fsthttp.StatusGatewayTimeout:
+		c = Unavailable
+	default:
+		c = Unknown
+	}
+	return &StatusError{Code: c, Message: fmt.Sprintf("unexpected HTTP status code %d (%s)", code, fsthttp.StatusText(code))}
+}
+
+// statusFromHeader returns the status in the grpc-status and grpc-message
+// fields of h, which are trailers or, for a trailers-only response,
+// headers. It returns nil if the status is OK, and false if h has no
+// grpc-status.
+func statusFromHeader(h fsthttp.Header) (*StatusError, bool) {
+	v := h.Get("Grpc-Status")
+	if v == "" {
+		return nil, false
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return &StatusError{Code: Internal, Message: fmt.Sprintf("malformed grpc-status %q", v)}, true
+	}
+	if Code(n) == OK {
+		return nil, true
+	}
+	return &StatusError{Code: Code(n), Message: decodeMessage(h.Get("Grpc-Message"))}, true
+}
+
+// encodeMessage percent-encodes a status message for the grpc-message
+// field.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// decodeMessage decodes a percent-encoded grpc-message field. Malformed
+// escapes are left as they are.
+func decodeMessage(msg string) string {
+	if !strings.Contains(msg, "%") {
+		return msg
+	}
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if msg[i] == '%' && i+2 < len(msg) {
+			if n, err := strconv.ParseUint(msg[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(msg[i])
+	}
+	return b.String()
+}
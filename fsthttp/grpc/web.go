@@ -0,0 +1,240 @@
+// Copyright 2022 Fastly, Inc.
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// WebProxy is an [fsthttp.Handler] that accepts gRPC-Web requests, as sent
+// by browsers, and forwards them as gRPC requests to a backend.
+//
+// Requests with a Content-Type of application/grpc-web, optionally with a
+// subtype such as application/grpc-web+proto, are forwarded as they are.
+// Requests with a Content-Type of application/grpc-web-text have base64
+// encoded bodies, which are decoded, and their responses are encoded. The
+// status and trailers of the gRPC response are sent to the client in the
+// gRPC-Web trailer frame at the end of the response body. See
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md.
+//
+// WebProxy does not handle CORS. If the page making the requests is not
+// served from the same origin, wrap WebProxy in a handler which answers
+// preflight requests, and exposes the grpc-status and grpc-message headers.
+type WebProxy struct {
+	// Backend is the name of the gRPC backend requests are sent to.
+	Backend string
+
+	// Director, if non-nil, modifies the outgoing gRPC request before it
+	// is sent.
+	Director func(r *fsthttp.Request)
+}
+
+// NewWebProxy returns a WebProxy which sends requests to the named backend.
+func NewWebProxy(backend string) *WebProxy {
+	return &WebProxy{Backend: backend}
+}
+
+// ServeHTTP translates the gRPC-Web request into a gRPC request, sends it to
+// the backend, and translates the response.
+func (p *WebProxy) ServeHTTP(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+	if r.Method != fsthttp.MethodPost {
+		w.Header().Set("Allow", fsthttp.MethodPost)
+		fsthttp.Error(w, fsthttp.StatusText(fsthttp.StatusMethodNotAllowed), fsthttp.StatusMethodNotAllowed)
+		return
+	}
+	text, subtype, ok := parseWebContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		fsthttp.Error(w, fsthttp.StatusText(fsthttp.StatusUnsupportedMediaType), fsthttp.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if text {
+		b, err := io.ReadAll(r.Body)
+		if err == nil {
+			b, err = decodeBase64Chunks(b)
+		}
+		if err != nil {
+			writeWebStatus(w, text, subtype, Errorf(InvalidArgument, "malformed grpc-web-text request body"))
+			return
+		}
+		body = bytes.NewReader(b)
+	}
+
+	out := r.CloneWithBody(body)
+	out.CacheOptions.Pass = true
+
+	out.Header.Set("Content-Type", contentType(subtype))
+	out.Header.Set("TE", "trailers")
+	out.Header.Del("Content-Length")
+	out.Header.Del("X-Grpc-Web")
+	if p.Director != nil {
+		p.Director(out)
+	}
+
+	resp, err := out.Send(ctx, p.Backend)
+	if err != nil {
+		writeWebStatus(w, text, subtype, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != fsthttp.StatusOK {
+		writeWebStatus(w, text, subtype, statusFromHTTP(resp.StatusCode))
+		return
+	}
+
+	for k, vs := range resp.Header {
+		switch k {
+		case "Content-Length", "Content-Type", "Trailer", "Transfer-Encoding", "Connection":
+			continue
+		}
+		w.Header()[k] = vs
+	}
+	w.Header().Set("Content-Type", webContentType(text, subtype))
+
+	w.WriteHeader(fsthttp.StatusOK)
+
+	// A trailers-only response carries its status in the headers, which
+	// gRPC-Web clients accept too.
+	if _, ok := statusFromHeader(resp.Header); ok {
+		return
+	}
+
+	var dst io.Writer = w
+	if text {
+		dst = &base64Writer{w: w}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		writeTrailerFrame(dst, trailersFor(err))
+		return
+	}
+
+	trailer, err := resp.Trailers()
+	if err != nil {
+		trailer = trailersFor(Errorf(Internal, "read trailers: %v", err))
+	} else if _, ok := statusFromHeader(trailer); !ok {
+		trailer = trailersFor(Errorf(Internal, "server closed the stream without sending trailers"))
+	}
+	writeTrailerFrame(dst, trailer)
+}
+
+// parseWebContentType parses the Content-Type of a gRPC-Web request,
+// returning whether it is the text format, and its subtype.
+func parseWebContentType(ct string) (text bool, subtype string, ok bool) {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false, "", false
+	}
+	base, subtype, _ := strings.Cut(mt, "+")
+	switch base {
+	case "application/grpc-web":
+		return false, subtype, true
+	case "application/grpc-web-text":
+		return true, subtype, true
+	}
+	return false, "", false
+}
+
+func webContentType(text bool, subtype string) string {
+	ct := "application/grpc-web"
+	if text {
+		ct += "-text"
+	}
+	if subtype != "" {
+		ct += "+" + subtype
+	}
+	return ct
+}
+
+// writeWebStatus responds with a trailers-only response carrying the status
+// of err.
+func writeWebStatus(w fsthttp.ResponseWriter, text bool, subtype string, err error) {
+	w.Header().Set("Content-Type", webContentType(text, subtype))
+	for k, vs := range trailersFor(err) {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(fsthttp.StatusOK)
+}
+
+// trailersFor returns the grpc-status and grpc-message fields for the status
+// of err, which is converted with statusFromError.
+func trailersFor(err error) fsthttp.Header {
+	var se *StatusError
+	errors.As(statusFromError(err), &se)
+	h := fsthttp.NewHeader()
+	h.Set("Grpc-Status", strconv.FormatUint(uint64(se.Code), 10))
+	h.Set("Grpc-Message", encodeMessage(se.Message))
+	return h
+}
+
+// writeTrailerFrame writes the gRPC-Web trailer frame holding trailer,
+// formatted as HTTP/1 header fields with lower-case names.
+func writeTrailerFrame(w io.Writer, trailer fsthttp.Header) {
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			b.WriteString(strings.ToLower(k))
+			b.WriteString(": ")
+			b.WriteString(v)
+			b.WriteString("\r\n")
+		}
+	}
+	w.Write(appendFrame(nil, flagTrailer, b.Bytes()))
+}
+
+// base64Writer base64 encodes each write separately, as gRPC-Web clients
+// decode concatenated, padded, base64 chunks.
+type base64Writer struct {
+	w io.Writer
+}
+
+func (bw *base64Writer) Write(p []byte) (int, error) {
+	if _, err := bw.w.Write([]byte(base64.StdEncoding.EncodeToString(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+var errMalformedBase64 = errors.New("grpc: malformed base64")
+
+// decodeBase64Chunks decodes concatenated base64 chunks, each of which may
+// end with padding.
+func decodeBase64Chunks(b []byte) ([]byte, error) {
+	b = bytes.Join(bytes.Fields(b), nil)
+	if len(b)%4 != 0 {
+		return nil, errMalformedBase64
+	}
+	var out []byte
+	for len(b) > 0 {
+		// The chunk ends at the first padded quantum.
+		n := len(b)
+		if i := bytes.IndexByte(b, '='); i >= 0 {
+			n = (i/4 + 1) * 4
+		}
+		dst := make([]byte, base64.StdEncoding.DecodedLen(n))
+		m, err := base64.StdEncoding.Decode(dst, b[:n])
+		if err != nil {
+			return nil, errMalformedBase64
+		}
+		out = append(out, dst[:m]...)
+		b = b[n:]
+	}
+	return out, nil
+}
@@ -0,0 +1,165 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+// webResponse splits a gRPC-Web response body into its messages and
+// trailer frame.
+func webResponse(t *testing.T, body []byte, text bool) (msgs []string, trailer string) {
+	t.Helper()
+	if text {
+		var err error
+		if body, err = decodeBase64Chunks(body); err != nil {
+			t.Fatalf("decode response body: %v", err)
+		}
+	}
+	r := bytes.NewReader(body)
+	for {
+		flags, msg, err := readFrame(r, defaultMaxRecvMsgSize)
+		if err == io.EOF {
+			return msgs, trailer
+		}
+		if err != nil {
+			t.Fatalf("read response frame: %v", err)
+		}
+		if flags&flagTrailer != 0 {
+			if r.Len() != 0 {
+				t.Errorf("%d bytes after trailer frame", r.Len())
+			}
+			trailer = string(msg)
+			continue
+		}
+		msgs = append(msgs, string(msg))
+	}
+}
+
+func TestWebProxy(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	var got fsthttp.Request
+	h.AddBackend("greeter", echoServer(t, &got))
+
+	for _, tt := range []struct {
+		contentType string
+		text        bool
+		status      string
+		wantTrailer string
+	}{
+		{"application/grpc-web+proto", false, "0", "grpc-status: 0\r\n"},
+		{"application/grpc-web-text", true, "0", "grpc-status: 0\r\n"},
+		{"application/grpc-web-text+proto", true, "5", "grpc-message: failed: 100%25 %E2%9C%97\r\ngrpc-status: 5\r\n"},
+	} {
+		reqBody := appendFrame(nil, 0, []byte("hello"))
+		if tt.text {
+			// Send the frame as two padded chunks.
+			reqBody = []byte(base64.StdEncoding.EncodeToString(reqBody[:4]) + base64.StdEncoding.EncodeToString(reqBody[4:]))
+		}
+		req, err := fsthttp.NewRequest(fsthttp.MethodPost, "https://example.com/helloworld.Greeter/SayHellos", bytes.NewReader(reqBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("X-Grpc-Web", "1")
+		req.Header.Set("N", "2")
+		req.Header.Set("Status", tt.status)
+
+		w := fsttest.NewRecorder()
+		NewWebProxy("greeter").ServeHTTP(context.Background(), w, req)
+
+		if w.Code != fsthttp.StatusOK {
+			t.Errorf("%s: status = %d, want 200", tt.contentType, w.Code)
+		}
+		if ct := w.HeaderMap.Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: response content type = %q", tt.contentType, ct)
+		}
+		if ct := got.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc") || strings.Contains(ct, "web") {
+			t.Errorf("%s: upstream content type = %q", tt.contentType, ct)
+		}
+		if got.Header.Get("TE") != "trailers" || got.Header.Get("X-Grpc-Web") != "" {
+			t.Errorf("%s: upstream headers = %v", tt.contentType, got.Header)
+		}
+
+		msgs, trailer := webResponse(t, w.Body.Bytes(), tt.text)
+		if len(msgs) != 2 || msgs[0] != "hello" || msgs[1] != "hello" {
+			t.Errorf("%s: messages = %q, want two hellos", tt.contentType, msgs)
+		}
+		if trailer != tt.wantTrailer {
+			t.Errorf("%s: trailer frame = %q, want %q", tt.contentType, trailer, tt.wantTrailer)
+		}
+	}
+}
+
+func TestWebProxyErrors(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	h.AddBackend("missing", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		fsthttp.Error(w, "not found", fsthttp.StatusNotFound)
+	}))
+	h.AddBackend("refused", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+	h.FailBackend("refused", fsthttp.SendErrorConnectionRefused, -1)
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		backend     string
+		wantCode    int
+		wantStatus  string
+	}{
+		{"get", fsthttp.MethodGet, "application/grpc-web", "", "missing", fsthttp.StatusMethodNotAllowed, ""},
+		{"json", fsthttp.MethodPost, "application/json", "", "missing", fsthttp.StatusUnsupportedMediaType, ""},
+		{"bad base64", fsthttp.MethodPost, "application/grpc-web-text", "AA=A", "missing", fsthttp.StatusOK, "3"},
+		{"not found", fsthttp.MethodPost, "application/grpc-web", "", "missing", fsthttp.StatusOK, "12"},
+		{"refused", fsthttp.MethodPost, "application/grpc-web", "", "refused", fsthttp.StatusOK, "14"},
+	} {
+		req, err := fsthttp.NewRequest(tt.method, "https://example.com/s/m", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", tt.contentType)
+
+		w := fsttest.NewRecorder()
+		NewWebProxy(tt.backend).ServeHTTP(context.Background(), w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if s := w.HeaderMap.Get("Grpc-Status"); s != tt.wantStatus {
+			t.Errorf("%s: grpc-status = %q, want %q", tt.name, s, tt.wantStatus)
+		}
+	}
+}
+
+func TestDecodeBase64Chunks(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"aGVsbG8=", "hello", false},
+		{"aGk=aGVsbG8=", "hihello", false},
+		{"aGk=\r\naGk=", "hihi", false},
+		{"aGVsbG8", "", true},
+		{"aG=k", "", true},
+	} {
+		got, err := decodeBase64Chunks([]byte(tt.in))
+		if (err != nil) != tt.wantErr || string(got) != tt.want {
+			t.Errorf("decodeBase64Chunks(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
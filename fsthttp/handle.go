@@ -5,6 +5,10 @@ package fsthttp
 import (
 	"context"
 	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
@@ -16,18 +20,70 @@ import (
 // request. Serve will ensure the ResponseWriter has been closed before
 // returning, and so should only be called once per execution.
 func Serve(h Handler) {
+	ServeWithOptions(h, nil)
+}
+
+// ServeWithOptions is like Serve, but with options controlling how the
+// request is served. A nil opts is equivalent to calling Serve.
+func ServeWithOptions(h Handler, opts *ServeOptions) {
 	abireq, abibody, err := fastly.BodyDownstreamGet()
 	if err != nil {
 		panic(fmt.Errorf("get client handles: %w", err))
 	}
 
-	serve(h, abireq, abibody, 1)
+	serve(h, abireq, abibody, 1, opts)
 
 	// wait for any stale-while-revalidate goroutines to complete.
 	guestCacheSWRPending.Wait()
 }
 
-func serve(h Handler, abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, sandboxRequests int) {
+// ServeOptions controls how requests are served by ServeWithOptions and
+// ServeMany.
+type ServeOptions struct {
+	// RecoverPanics enables recovery from panics in the handler. Without
+	// it, a panic terminates the instance, and the client receives
+	// whatever response the platform produces.
+	//
+	// When a panic is recovered and the response headers have not yet been
+	// sent, PanicResponse is used to respond to the client. If the headers
+	// have been sent, the response body is abandoned, so the client sees
+	// an incomplete response rather than a truncated one.
+	RecoverPanics bool
+
+	// PanicResponse writes the response to the client after a recovered
+	// panic, with the value passed to panic. If nil, PanicResponseText is
+	// used.
+	PanicResponse func(w ResponseWriter, r *Request, recovered any)
+
+	// PanicLog, if non-nil, receives a report of each recovered panic,
+	// with the request ID, the value passed to panic, and the stack trace.
+	// Each report is written with a single call to Write, so an
+	// *rtlog.Endpoint records it as a single log event.
+	PanicLog io.Writer
+
+	// ContinueAfterPanic determines whether ServeMany continues serving
+	// requests after recovering from a panic. If ContinueAfterPanic is nil
+	// or returns false, ServeMany exits after responding to the request,
+	// since the panic may have left the program in an inconsistent state.
+	ContinueAfterPanic func(recovered any) bool
+}
+
+// PanicResponseText responds to the client with a plain text 500 Internal
+// Server Error response. It is the default ServeOptions.PanicResponse.
+func PanicResponseText(w ResponseWriter, r *Request, recovered any) {
+	Error(w, StatusText(StatusInternalServerError), StatusInternalServerError)
+}
+
+// PanicResponseProblem responds to the client with a 500 Internal Server
+// Error response in the application/problem+json format of RFC 9457.
+func PanicResponseProblem(w ResponseWriter, r *Request, recovered any) {
+	(&Problem{Status: StatusInternalServerError}).writeJSON(w)
+}
+
+// serve handles a single client request with h. If opts enables panic
+// recovery, serve returns whether h panicked, and the value passed to
+// panic.
+func serve(h Handler, abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, sandboxRequests int, opts *ServeOptions) (panicked bool, recovered any) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -42,7 +98,14 @@ func serve(h Handler, abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, sand
 		panic(fmt.Errorf("create client ResponseWriter: %w", err))
 	}
 
-	h.ServeHTTP(ctx, clientResponseWriter, clientRequest)
+	if opts != nil && opts.RecoverPanics {
+		panicked, recovered = serveRecover(ctx, h, clientResponseWriter, clientRequest, opts)
+		if panicked {
+			return panicked, recovered
+		}
+	} else {
+		h.ServeHTTP(ctx, clientResponseWriter, clientRequest)
+	}
 
 	// If we were unable to send the response due to an error, panic and hope we sent a 500.
 	if clientResponseWriter.sendErr != nil {
@@ -50,10 +113,58 @@ func serve(h Handler, abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, sand
 	}
 
 	clientResponseWriter.Close()
+	return false, nil
+}
+
+// serveRecover calls h, recovering from any panic. After a panic, it
+// reports the panic and responds to the client.
+func serveRecover(ctx context.Context, h Handler, w *responseWriter, r *Request, opts *ServeOptions) (panicked bool, recovered any) {
+	func() {
+		defer func() {
+			if recovered = recover(); recovered != nil {
+				panicked = true
+				reportPanic(opts.PanicLog, r, recovered, debug.Stack())
+			}
+		}()
+		h.ServeHTTP(ctx, w, r)
+	}()
+	if !panicked {
+		return false, nil
+	}
+
+	if w.closed {
+		return panicked, recovered
+	}
+	if w.wroteHeaders {
+		w.abiBody.Abandon()
+		return panicked, recovered
+	}
+
+	respond := opts.PanicResponse
+	if respond == nil {
+		respond = PanicResponseText
+	}
+	respond(w, r, recovered)
+	w.Close()
+	return panicked, recovered
+}
+
+func reportPanic(log io.Writer, r *Request, recovered any, stack []byte) {
+	if log == nil {
+		return
+	}
+	var requestID string
+	if meta, err := r.FastlyMeta(); err == nil {
+		requestID = meta.RequestID
+	}
+	log.Write(fmt.Appendf(nil, "fsthttp: panic serving request %s: %v\n\n%s", requestID, recovered, stack))
 }
 
 // ServeManyOptions controls the exit conditions for ServeMany.  Note that Compute might terminate the request hander earlier.
 type ServeManyOptions struct {
+	// ServeOptions controls how each request is served.
+	ServeOptions
+
 	// NextTimeout is the amount of time to wait for the next request
 	NextTimeout time.Duration
 
@@ -63,62 +174,381 @@ type ServeManyOptions struct {
 	// MaxRequests is the maximum number of requests to serve for a single instance
 	MaxRequests int
 
+	// MaxHeapMiB is the dynamic memory usage, in mebibytes, at or above
+	// which an instance stops serving requests, as reported by
+	// compute.GetHeapMiB.  If zero, memory usage is not checked.
+	MaxHeapMiB uint32
+
+	// MaxVCPUTime is the vCPU time at or above which an instance stops
+	// serving requests, as reported by compute.GetVCPUTime.  If zero, vCPU
+	// time is not checked.
+	MaxVCPUTime time.Duration
+
+	// MaxConcurrency is the maximum number of requests handled at once.
+	// If it is greater than one, ServeMany waits for the next request
+	// while earlier requests are still being handled, and calls the
+	// handler for each request in its own goroutine, with its own context
+	// and ResponseWriter.  This keeps a long streaming response from
+	// delaying the next client.  If zero or one, requests are handled one
+	// after another.
+	//
+	// Goroutines on Compute share a single thread, so while handlers are
+	// running ServeMany polls for the next request rather than blocking
+	// the thread until it arrives.
+	MaxConcurrency int
+
 	// Continue is a function that determines whether to continue
 	// serving requests after the other conditions have been checked.
 	// If Continue returns false, ServeMany will exit.  If Continue is
 	// nil or returns true, ServeMany will continue.
 	Continue func() bool
+
+	// OnStart, if non-nil, is called when ServeMany starts, before the
+	// first request is served.
+	OnStart func()
+
+	// OnRequestDone, if non-nil, is called after each request has been
+	// served.  With a MaxConcurrency greater than one, it may be called
+	// concurrently.
+	OnRequestDone func(stats ServeManyStats)
+
+	// OnExit, if non-nil, is called with the reason ServeMany stopped
+	// serving requests, once every request has been served.
+	OnExit func(reason ServeManyExitReason)
+}
+
+// ServeManyStats describes a request served by ServeMany, and the state of
+// the instance after serving it.
+type ServeManyStats struct {
+	// Request is the number of the request within the instance, starting
+	// at 1.
+	Request int
+
+	// Duration is how long the request took to serve.
+	Duration time.Duration
+
+	// Panicked reports whether the handler panicked.
+	Panicked bool
+
+	// Uptime is how long the instance has been running.
+	Uptime time.Duration
+
+	// HeapMiB is the dynamic memory usage of the instance, in mebibytes,
+	// or zero if it is not available.
+	HeapMiB uint32
+
+	// VCPUTime is the vCPU time used by the instance, or zero if it is
+	// not available.
+	VCPUTime time.Duration
+}
+
+// ServeManyExitReason is the reason ServeMany stopped serving requests.
+type ServeManyExitReason int
+
+const (
+	// ServeManyExitNoRequest means no next request arrived within the
+	// NextTimeout.
+	ServeManyExitNoRequest ServeManyExitReason = iota
+
+	// ServeManyExitMaxRequests means MaxRequests requests were served.
+	ServeManyExitMaxRequests
+
+	// ServeManyExitMaxLifetime means the instance reached its MaxLifetime.
+	ServeManyExitMaxLifetime
+
+	// ServeManyExitMaxHeap means the instance reached MaxHeapMiB.
+	ServeManyExitMaxHeap
+
+	// ServeManyExitMaxVCPUTime means the instance reached MaxVCPUTime.
+	ServeManyExitMaxVCPUTime
+
+	// ServeManyExitContinue means the Continue function returned false.
+	ServeManyExitContinue
+
+	// ServeManyExitPanic means a handler panicked, and ContinueAfterPanic
+	// did not allow ServeMany to continue.
+	ServeManyExitPanic
+)
+
+// String implements fmt.Stringer.
+func (r ServeManyExitReason) String() string {
+	switch r {
+	case ServeManyExitNoRequest:
+		return "no request"
+	case ServeManyExitMaxRequests:
+		return "max requests"
+	case ServeManyExitMaxLifetime:
+		return "max lifetime"
+	case ServeManyExitMaxHeap:
+		return "max heap"
+	case ServeManyExitMaxVCPUTime:
+		return "max vCPU time"
+	case ServeManyExitContinue:
+		return "continue"
+	case ServeManyExitPanic:
+		return "panic"
+	}
+	return fmt.Sprintf("ServeManyExitReason(%d)", int(r))
+}
+
+func (o *ServeManyOptions) continueAfterPanic(recovered any) bool {
+	return o.ContinueAfterPanic != nil && o.ContinueAfterPanic(recovered)
+}
+
+// canServe reports whether ServeMany should serve the nth request of an
+// instance which started at start and, if not, why.
+func (o *ServeManyOptions) canServe(n int, start time.Time) (ServeManyExitReason, bool) {
+	if o.MaxRequests != 0 && n > o.MaxRequests {
+		return ServeManyExitMaxRequests, false
+	}
+
+	if o.MaxLifetime != 0 && time.Since(start) > o.MaxLifetime {
+		return ServeManyExitMaxLifetime, false
+	}
+
+	if o.MaxHeapMiB != 0 {
+		if heap, err := getHeapMiB(); err == nil && heap >= o.MaxHeapMiB {
+			return ServeManyExitMaxHeap, false
+		}
+	}
+
+	if o.MaxVCPUTime != 0 {
+		if vcpu, err := vcpuTime(); err == nil && vcpu >= o.MaxVCPUTime {
+			return ServeManyExitMaxVCPUTime, false
+		}
+	}
+
+	if o.Continue != nil && !o.Continue() {
+		return ServeManyExitContinue, false
+	}
+
+	return 0, true
+}
+
+// serve serves the nth request of an instance which started at start, and
+// reports whether ServeMany should stop because the handler panicked.
+func (o *ServeManyOptions) serve(h Handler, abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, n int, start time.Time) (stop bool) {
+	begin := time.Now()
+	panicked, recovered := serveRequest(h, abireq, abibody, n, &o.ServeOptions)
+
+	if o.OnRequestDone != nil {
+		stats := ServeManyStats{
+			Request:  n,
+			Duration: time.Since(begin),
+			Panicked: panicked,
+			Uptime:   time.Since(start),
+		}
+		stats.HeapMiB, _ = getHeapMiB()
+		stats.VCPUTime, _ = vcpuTime()
+		o.OnRequestDone(stats)
+	}
+
+	return panicked && !o.continueAfterPanic(recovered)
+}
+
+// The hostcalls ServeMany uses to read the resource usage of the instance,
+// which tests replace.
+var (
+	getHeapMiB          = fastly.GetHeapMiB
+	getVCPUMilliseconds = fastly.GetVCPUMilliseconds
+)
+
+func vcpuTime() (time.Duration, error) {
+	ms, err := getVCPUMilliseconds()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
 }
 
 // ServeMany allows a single Compute instance to handle multiple requests.
 func ServeMany(h HandlerFunc, serveOpts *ServeManyOptions) {
+	if serveOpts.OnStart != nil {
+		serveOpts.OnStart()
+	}
+
+	var reason ServeManyExitReason
+	if serveOpts.MaxConcurrency > 1 {
+		reason = serveManyConcurrent(h, serveOpts)
+	} else {
+		reason = serveMany(h, serveOpts)
+	}
+
+	// wait for any stale-while-revalidate goroutines to complete.
+	guestCacheSWRPending.Wait()
+
+	if serveOpts.OnExit != nil {
+		serveOpts.OnExit(reason)
+	}
+}
+
+// serveMany serves requests one after another.
+func serveMany(h HandlerFunc, serveOpts *ServeManyOptions) ServeManyExitReason {
 	start := time.Now()
 	requestCount := 1
 
-	abireq, abibody, err := fastly.BodyDownstreamGet()
+	abireq, abibody, err := downstreamRequest()
 	if err != nil {
 		panic(fmt.Errorf("get client handles: %w", err))
 	}
-	serve(h, abireq, abibody, requestCount)
+	if serveOpts.serve(h, abireq, abibody, requestCount, start) {
+		return ServeManyExitPanic
+	}
 
 	// Serve the rest
 	for {
 		requestCount++
-		if serveOpts.MaxRequests != 0 && requestCount > serveOpts.MaxRequests {
-			break
+		if reason, ok := serveOpts.canServe(requestCount, start); !ok {
+			return reason
 		}
 
-		if serveOpts.MaxLifetime != 0 && time.Since(start) > serveOpts.MaxLifetime {
-			break
+		abireq, abibody, ok := nextRequest(serveOpts)
+		if !ok {
+			return ServeManyExitNoRequest
 		}
 
-		if serveOpts.Continue != nil && !serveOpts.Continue() {
-			break
+		if serveOpts.serve(h, abireq, abibody, requestCount, start) {
+			return ServeManyExitPanic
+		}
+	}
+}
+
+// serveManyConcurrent serves up to MaxConcurrency requests at once. It
+// returns once the running handlers have completed.
+func serveManyConcurrent(h HandlerFunc, serveOpts *ServeManyOptions) ServeManyExitReason {
+	start := time.Now()
+	requestCount := 1
+
+	var (
+		handlers sync.WaitGroup
+		running  atomic.Int32
+		slots    = make(chan struct{}, serveOpts.MaxConcurrency)
+		stop     atomic.Bool
+	)
+	defer handlers.Wait()
+
+	handle := func(abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, n int) {
+		defer handlers.Done()
+		defer func() {
+			running.Add(-1)
+			<-slots
+		}()
+		if serveOpts.serve(h, abireq, abibody, n, start) {
+			stop.Store(true)
+		}
+	}
+	spawn := func(abireq *fastly.HTTPRequest, abibody *fastly.HTTPBody, n int) {
+		running.Add(1)
+		handlers.Add(1)
+		go handle(abireq, abibody, n)
+	}
+
+	abireq, abibody, err := downstreamRequest()
+	if err != nil {
+		panic(fmt.Errorf("get client handles: %w", err))
+	}
+	slots <- struct{}{}
+	spawn(abireq, abibody, requestCount)
+
+	// Serve the rest
+	for {
+		if stop.Load() {
+			return ServeManyExitPanic
+		}
+
+		requestCount++
+		if reason, ok := serveOpts.canServe(requestCount, start); !ok {
+			return reason
+		}
+
+		// Wait for a free slot, letting the running handlers make
+		// progress.
+		slots <- struct{}{}
+		if stop.Load() {
+			return ServeManyExitPanic
 		}
 
-		var opts fastly.NextRequestOptions
-		if serveOpts.NextTimeout != 0 {
-			opts.Timeout(serveOpts.NextTimeout)
+		abireq, abibody, ok := pollNextRequest(serveOpts, &running, &handlers)
+		if !ok {
+			return ServeManyExitNoRequest
 		}
 
-		promise, err := fastly.DownstreamNextRequest(&opts)
+		spawn(abireq, abibody, requestCount)
+	}
+}
+
+// The hostcalls ServeMany uses to get and serve client requests, which tests
+// replace.
+var (
+	downstreamRequest     = fastly.BodyDownstreamGet
+	downstreamNextRequest = func(opts *fastly.NextRequestOptions) (requestPromise, error) {
+		p, err := fastly.DownstreamNextRequest(opts)
 		if err != nil {
-			panic(fmt.Errorf("get next request promise: %w", err))
+			return nil, err
 		}
+		return p, nil
+	}
+	serveRequest = serve
+)
+
+// requestPromise is a promise for the next client request.
+type requestPromise interface {
+	IsReady() (bool, error)
+	Wait() (*fastly.HTTPRequest, *fastly.HTTPBody, error)
+}
+
+// nextRequestPollInterval is how often pollNextRequest checks whether the
+// next request has arrived.
+const nextRequestPollInterval = time.Millisecond
 
-		abireq, abibody, err := promise.Wait()
+// nextRequest waits for the next client request. It returns false if there
+// is no next request before the NextTimeout.
+func nextRequest(serveOpts *ServeManyOptions) (*fastly.HTTPRequest, *fastly.HTTPBody, bool) {
+	return waitRequest(newRequestPromise(serveOpts))
+}
+
+// pollNextRequest waits for the next client request like nextRequest. While
+// handlers are running, it polls for the request rather than blocking in
+// Wait, which would stop every goroutine until the request arrived. If the
+// host cannot poll for it, the handlers are left to complete first.
+func pollNextRequest(serveOpts *ServeManyOptions, running *atomic.Int32, handlers *sync.WaitGroup) (*fastly.HTTPRequest, *fastly.HTTPBody, bool) {
+	promise := newRequestPromise(serveOpts)
+	for running.Load() > 0 {
+		ready, err := promise.IsReady()
 		if err != nil {
-			if status, ok := fastly.IsFastlyError(err); ok && status == fastly.FastlyStatusNone {
-				break
-			}
-			panic(fmt.Errorf("get client handles: %w", err))
+			handlers.Wait()
+			break
 		}
+		if ready {
+			break
+		}
+		time.Sleep(nextRequestPollInterval)
+	}
+	return waitRequest(promise)
+}
 
-		serve(h, abireq, abibody, requestCount)
+func newRequestPromise(serveOpts *ServeManyOptions) requestPromise {
+	var opts fastly.NextRequestOptions
+	if serveOpts.NextTimeout != 0 {
+		opts.Timeout(serveOpts.NextTimeout)
 	}
 
-	// wait for any stale-while-revalidate goroutines to complete.
-	guestCacheSWRPending.Wait()
+	promise, err := downstreamNextRequest(&opts)
+	if err != nil {
+		panic(fmt.Errorf("get next request promise: %w", err))
+	}
+	return promise
+}
+
+func waitRequest(promise requestPromise) (*fastly.HTTPRequest, *fastly.HTTPBody, bool) {
+	abireq, abibody, err := promise.Wait()
+	if err != nil {
+		if status, ok := fastly.IsFastlyError(err); ok && status == fastly.FastlyStatusNone {
+			return nil, nil, false
+		}
+		panic(fmt.Errorf("get client handles: %w", err))
+	}
+	return abireq, abibody, true
 }
 
 // ServeFunc is sugar for Serve(HandlerFunc(f)).
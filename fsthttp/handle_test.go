@@ -0,0 +1,379 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+func TestServeRecover(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name        string
+		handler     HandlerFunc
+		respond     func(w ResponseWriter, r *Request, recovered any)
+		wantCode    int
+		wantType    string
+		wantBody    string
+		wantAbandon bool
+	}{
+		{
+			name: "before headers",
+			handler: func(ctx context.Context, w ResponseWriter, r *Request) {
+				w.Header().Set("X-Partial", "1")
+				panic("boom")
+			},
+			wantCode: StatusInternalServerError,
+			wantType: "text/plain; charset=utf-8",
+			wantBody: "Internal Server Error\n",
+		},
+		{
+			name: "problem",
+			handler: func(ctx context.Context, w ResponseWriter, r *Request) {
+				panic("boom")
+			},
+			respond:  PanicResponseProblem,
+			wantCode: StatusInternalServerError,
+			wantType: "application/problem+json",
+			wantBody: `{"type":"about:blank","title":"Internal Server Error","status":500}` + "\n",
+		},
+		{
+			name: "after headers",
+			handler: func(ctx context.Context, w ResponseWriter, r *Request) {
+				w.WriteHeader(StatusOK)
+				w.Write([]byte("partial"))
+				panic("boom")
+			},
+			wantCode:    StatusOK,
+			wantAbandon: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := NewRequest("GET", "https://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, err := newResponseWriter()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var log bytes.Buffer
+			opts := &ServeOptions{RecoverPanics: true, PanicLog: &log, PanicResponse: tt.respond}
+			panicked, recovered := serveRecover(context.Background(), tt.handler, w, r, opts)
+			if !panicked || recovered != "boom" {
+				t.Fatalf("serveRecover = %v, %v; want true, boom", panicked, recovered)
+			}
+
+			if got, _ := w.abiResp.GetStatusCode(); got != tt.wantCode {
+				t.Errorf("status = %d, want %d", got, tt.wantCode)
+			}
+			body, err := io.ReadAll(w.abiBody)
+			if tt.wantAbandon {
+				if err == nil {
+					t.Errorf("body read error = nil, want abandoned body error")
+				}
+			} else {
+				if got := string(body); got != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+				if got, _ := w.abiResp.GetHeaderValue("Content-Type"); got != tt.wantType {
+					t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+				}
+			}
+
+			report := log.String()
+			if !strings.Contains(report, "panic serving request") || !strings.Contains(report, "boom") || !strings.Contains(report, "handle_test.go") {
+				t.Errorf("panic report missing details:\n%s", report)
+			}
+		})
+	}
+}
+
+func TestServeManyOptionsContinueAfterPanic(t *testing.T) {
+	t.Parallel()
+
+	var opts ServeManyOptions
+	if opts.continueAfterPanic("boom") {
+		t.Errorf("continueAfterPanic = true with no ContinueAfterPanic, want false")
+	}
+	opts.ContinueAfterPanic = func(recovered any) bool { return recovered == "recoverable" }
+	if !opts.continueAfterPanic("recoverable") {
+		t.Errorf("continueAfterPanic = false, want true")
+	}
+}
+
+func TestServeManyOptionsCanServe(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	for _, tt := range []struct {
+		name       string
+		opts       ServeManyOptions
+		n          int
+		start      time.Time
+		wantReason ServeManyExitReason
+		want       bool
+	}{
+		{"no limits", ServeManyOptions{}, 100, now.Add(-time.Hour), 0, true},
+		{"below max requests", ServeManyOptions{MaxRequests: 3}, 3, now, 0, true},
+		{"above max requests", ServeManyOptions{MaxRequests: 3}, 4, now, ServeManyExitMaxRequests, false},
+		{"within lifetime", ServeManyOptions{MaxLifetime: time.Minute}, 2, now, 0, true},
+		{"past lifetime", ServeManyOptions{MaxLifetime: time.Minute}, 2, now.Add(-2 * time.Minute), ServeManyExitMaxLifetime, false},
+		{"usage unavailable", ServeManyOptions{MaxHeapMiB: 1, MaxVCPUTime: time.Millisecond}, 2, now, 0, true},
+		{"continue", ServeManyOptions{Continue: func() bool { return true }}, 2, now, 0, true},
+		{"don't continue", ServeManyOptions{Continue: func() bool { return false }}, 2, now, ServeManyExitContinue, false},
+	} {
+		reason, ok := tt.opts.canServe(tt.n, tt.start)
+		if ok != tt.want || (!ok && reason != tt.wantReason) {
+			t.Errorf("%s: canServe = %v, %t, want %v, %t", tt.name, reason, ok, tt.wantReason, tt.want)
+		}
+	}
+}
+
+// fakePromise is a requestPromise for stubServeMany.
+type fakePromise struct {
+	isReady func() (bool, error)
+	wait    func()
+}
+
+func (p *fakePromise) IsReady() (bool, error) { return p.isReady() }
+
+func (p *fakePromise) Wait() (*fastly.HTTPRequest, *fastly.HTTPBody, error) {
+	if p.wait != nil {
+		p.wait()
+	}
+	return nil, nil, nil
+}
+
+// stubServeMany replaces the hostcalls used by ServeMany for the duration of
+// the test, so that every next request comes from next, and each request is
+// served by calling serve with its number within the instance.
+func stubServeMany(t *testing.T, next func() requestPromise, serve func(n int) (panicked bool)) {
+	t.Helper()
+	prevRequest, prevNext, prevServe := downstreamRequest, downstreamNextRequest, serveRequest
+	t.Cleanup(func() {
+		downstreamRequest, downstreamNextRequest, serveRequest = prevRequest, prevNext, prevServe
+	})
+
+	downstreamRequest = func() (*fastly.HTTPRequest, *fastly.HTTPBody, error) {
+		return nil, nil, nil
+	}
+	downstreamNextRequest = func(*fastly.NextRequestOptions) (requestPromise, error) {
+		return next(), nil
+	}
+	serveRequest = func(_ Handler, _ *fastly.HTTPRequest, _ *fastly.HTTPBody, n int, _ *ServeOptions) (bool, any) {
+		if serve(n) {
+			return true, "panic"
+		}
+		return false, nil
+	}
+}
+
+func noopHandler(context.Context, ResponseWriter, *Request) {}
+
+func TestServeManyConcurrent(t *testing.T) {
+	second := make(chan struct{})
+	var overlapped atomic.Bool
+	stubServeMany(t,
+		func() requestPromise {
+			return &fakePromise{isReady: func() (bool, error) { return true, nil }}
+		},
+		func(n int) bool {
+			switch n {
+			case 1:
+				// The first request is still being handled when the
+				// second one starts.
+				select {
+				case <-second:
+					overlapped.Store(true)
+				case <-time.After(5 * time.Second):
+				}
+			case 2:
+				close(second)
+			}
+			return false
+		},
+	)
+
+	var reason ServeManyExitReason
+	ServeMany(noopHandler, &ServeManyOptions{
+		MaxConcurrency: 2,
+		MaxRequests:    2,
+		OnExit:         func(r ServeManyExitReason) { reason = r },
+	})
+	if !overlapped.Load() {
+		t.Errorf("requests were not handled concurrently")
+	}
+	if reason != ServeManyExitMaxRequests {
+		t.Errorf("exit reason = %v, want %v", reason, ServeManyExitMaxRequests)
+	}
+}
+
+func TestServeManyConcurrentPolls(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		pollable bool
+	}{
+		{"pollable", true},
+		{"not pollable", false},
+	} {
+		var (
+			first = make(chan struct{})
+			polls atomic.Int32
+		)
+		done := func() bool {
+			select {
+			case <-first:
+				return true
+			default:
+				return false
+			}
+		}
+		stubServeMany(t,
+			func() requestPromise {
+				return &fakePromise{
+					isReady: func() (bool, error) {
+						polls.Add(1)
+						if !tt.pollable {
+							return false, errors.New("not implemented")
+						}
+						return done(), nil
+					},
+					wait: func() {
+						// Blocking in Wait would stop the running
+						// handler on Compute.
+						if !done() {
+							t.Errorf("%s: Wait called while a handler was running", tt.name)
+						}
+					},
+				}
+			},
+			func(n int) bool {
+				if n == 1 {
+					time.Sleep(20 * time.Millisecond)
+					close(first)
+				}
+				return false
+			},
+		)
+
+		ServeMany(noopHandler, &ServeManyOptions{MaxConcurrency: 2, MaxRequests: 2})
+		if polls.Load() == 0 {
+			t.Errorf("%s: next request was not polled", tt.name)
+		}
+	}
+}
+
+// stubUsage replaces the hostcalls ServeMany uses to read the resource usage
+// of the instance with heap and vcpu, for the duration of the test.
+func stubUsage(t *testing.T, heap *atomic.Uint32, vcpu *atomic.Uint64) {
+	t.Helper()
+	prevHeap, prevVCPU := getHeapMiB, getVCPUMilliseconds
+	t.Cleanup(func() { getHeapMiB, getVCPUMilliseconds = prevHeap, prevVCPU })
+
+	getHeapMiB = func() (uint32, error) { return heap.Load(), nil }
+	getVCPUMilliseconds = func() (uint64, error) { return vcpu.Load(), nil }
+}
+
+func readyPromise() requestPromise {
+	return &fakePromise{isReady: func() (bool, error) { return true, nil }}
+}
+
+func TestServeManyHooks(t *testing.T) {
+	var (
+		heap atomic.Uint32
+		vcpu atomic.Uint64
+	)
+	stubUsage(t, &heap, &vcpu)
+	stubServeMany(t, readyPromise, func(n int) bool {
+		heap.Store(uint32(10 * n))
+		vcpu.Store(uint64(100 * n))
+		return false
+	})
+
+	var events []string
+	ServeMany(noopHandler, &ServeManyOptions{
+		MaxRequests: 2,
+		OnStart:     func() { events = append(events, "start") },
+		OnRequestDone: func(stats ServeManyStats) {
+			if stats.Panicked || stats.Uptime < stats.Duration {
+				t.Errorf("request %d: stats = %+v", stats.Request, stats)
+			}
+			events = append(events, fmt.Sprintf("done %d heap=%d vcpu=%v", stats.Request, stats.HeapMiB, stats.VCPUTime))
+		},
+		OnExit: func(reason ServeManyExitReason) { events = append(events, "exit "+reason.String()) },
+	})
+
+	want := []string{
+		"start",
+		"done 1 heap=10 vcpu=100ms",
+		"done 2 heap=20 vcpu=200ms",
+		"exit max requests",
+	}
+	if got := strings.Join(events, "; "); got != strings.Join(want, "; ") {
+		t.Errorf("events = %s, want %s", got, strings.Join(want, "; "))
+	}
+}
+
+func TestServeManyExitReasons(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		opts        ServeManyOptions
+		panicAt     int
+		wantServed  int
+		wantReason  ServeManyExitReason
+		wantPanicky bool
+	}{
+		{"max heap", ServeManyOptions{MaxHeapMiB: 30}, 0, 3, ServeManyExitMaxHeap, false},
+		{"max vCPU time", ServeManyOptions{MaxVCPUTime: 200 * time.Millisecond}, 0, 2, ServeManyExitMaxVCPUTime, false},
+		{"panic", ServeManyOptions{MaxRequests: 5}, 2, 2, ServeManyExitPanic, true},
+	} {
+		var (
+			heap   atomic.Uint32
+			vcpu   atomic.Uint64
+			served atomic.Int32
+		)
+		stubUsage(t, &heap, &vcpu)
+		stubServeMany(t, readyPromise, func(n int) bool {
+			served.Add(1)
+			heap.Store(uint32(10 * n))
+			vcpu.Store(uint64(100 * n))
+			return n == tt.panicAt
+		})
+
+		var (
+			reason   ServeManyExitReason
+			panicked bool
+		)
+		opts := tt.opts
+		opts.OnRequestDone = func(stats ServeManyStats) { panicked = panicked || stats.Panicked }
+		opts.OnExit = func(r ServeManyExitReason) { reason = r }
+		ServeMany(noopHandler, &opts)
+
+		if got := int(served.Load()); got != tt.wantServed {
+			t.Errorf("%s: served %d requests, want %d", tt.name, got, tt.wantServed)
+		}
+		if reason != tt.wantReason {
+			t.Errorf("%s: exit reason = %v, want %v", tt.name, reason, tt.wantReason)
+		}
+		if panicked != tt.wantPanicky {
+			t.Errorf("%s: Panicked = %t, want %t", tt.name, panicked, tt.wantPanicky)
+		}
+	}
+}
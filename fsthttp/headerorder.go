@@ -0,0 +1,52 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import "fmt"
+
+// OriginalHeaderNames returns the names of the headers of the client
+// request, in the order and with the case in which the client sent them.
+// A name is repeated if the client sent the header more than once. Unlike
+// the Header map, it reflects the request as received, before any changes
+// made by the handler.
+//
+// FastlyMeta.OH is the platform's fingerprint of the same order. How it is
+// computed is not published, so it cannot be derived from the names, and
+// a fingerprint computed from them is not comparable with it.
+//
+// It returns an error if the request is not the client request.
+func (r *Request) OriginalHeaderNames() ([]string, error) {
+	if r.downstream.req == nil {
+		return nil, fmt.Errorf("downstream request not available")
+	}
+
+	keys := r.downstream.req.DownstreamOriginalHeaderNames()
+	if keys == nil {
+		return nil, fmt.Errorf("original header names not available")
+	}
+	var names []string
+	for keys.Next() {
+		names = append(names, string(keys.Bytes()))
+	}
+	if err := keys.Err(); err != nil {
+		return nil, fmt.Errorf("get original header names: %w", err)
+	}
+	return names, nil
+}
+
+// OriginalHeaderCount returns the number of headers of the client request
+// as received, counting each header the client sent more than once each
+// time it was sent.
+//
+// It returns an error if the request is not the client request.
+func (r *Request) OriginalHeaderCount() (int, error) {
+	if r.downstream.req == nil {
+		return 0, fmt.Errorf("downstream request not available")
+	}
+
+	n, err := r.downstream.req.DownstreamOriginalHeaderCount()
+	if err != nil {
+		return 0, fmt.Errorf("get original header count: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import "testing"
+
+func TestOriginalHeadersNotDownstream(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names, err := r.OriginalHeaderNames(); err == nil {
+		t.Errorf("OriginalHeaderNames of outgoing request = %q, want error", names)
+	}
+	if n, err := r.OriginalHeaderCount(); err == nil {
+		t.Errorf("OriginalHeaderCount of outgoing request = %d, want error", n)
+	}
+}
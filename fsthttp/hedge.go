@@ -0,0 +1,168 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SendFirstOptions control how [SendFirst] sends copies of a request.
+type SendFirstOptions struct {
+	// HedgeDelay is how long SendFirst waits for a successful response
+	// before sending a copy of the request to the next backend. A copy is
+	// sent at once if the previous copy fails. If zero, the delay is 50ms.
+	// If negative, copies are sent to every backend at once.
+	HedgeDelay time.Duration
+
+	// Successful reports whether a response is successful. Unsuccessful
+	// responses are treated like failures to send the request. If nil,
+	// responses with status codes below 500 are successful.
+	Successful func(*Response) bool
+
+	// MaxBodySize is the largest request body, in bytes, which is buffered
+	// so that it can be sent to more than one backend. A request with a
+	// larger body is only sent to the first backend. If zero, bodies of up
+	// to 1 MiB are buffered.
+	MaxBodySize int64
+}
+
+const defaultHedgeDelay = 50 * time.Millisecond
+
+// SendFirst sends the request to the first of the named backends and, if no
+// successful response has arrived after a delay, sends a copy of it to the
+// next backend, and so on, returning the first successful response. This
+// hedges against a slow or failing backend, at the cost of sending more
+// requests. The Backend field of the returned response names the backend
+// which answered. A nil opts uses the default options.
+//
+// Each copy of the request is a clone, with a copy of its body, which is read
+// into memory before the first copy is sent. The request itself is
+// considered sent, and may not be sent again.
+//
+// Once a response is chosen, requests which are still in flight are
+// abandoned, and the bodies of other responses are closed. If no response is
+// successful, SendFirst returns the first unsuccessful response, or if there
+// were none, an error joining the errors of each request.
+func SendFirst(ctx context.Context, req *Request, backends []string, opts *SendFirstOptions) (*Response, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("fsthttp: SendFirst requires at least one backend")
+	}
+	if req.sent {
+		return nil, fmt.Errorf("request already sent")
+	}
+	if opts == nil {
+		opts = &SendFirstOptions{}
+	}
+
+	delay := opts.HedgeDelay
+	if delay == 0 {
+		delay = defaultHedgeDelay
+	}
+	successful := opts.Successful
+	if successful == nil {
+		successful = func(resp *Response) bool { return resp.StatusCode < 500 }
+	}
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultRetryMaxBodySize
+	}
+
+	body, err := bufferBody(req, maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		// The body is too large to be sent more than once.
+		return req.Send(ctx, backends[0])
+	}
+	req.sent = true
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	type result struct {
+		resp *Response
+		err  error
+	}
+	results := make(chan result, len(backends))
+	send := func(backend string) {
+		r := req.cloneForResend(body.Bytes())
+		resp, err := r.Send(ctx, backend)
+		results <- result{resp, err}
+	}
+
+	var (
+		sent, received int
+		unsuccessful   *Response
+		errs           []error
+		winner         *Response
+	)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	go send(backends[sent])
+	sent++
+	if delay < 0 {
+		for ; sent < len(backends); sent++ {
+			go send(backends[sent])
+		}
+	}
+
+	for winner == nil && received < sent {
+		select {
+		case res := <-results:
+			received++
+			switch {
+			case res.err != nil:
+				errs = append(errs, res.err)
+			case successful(res.resp):
+				winner = res.resp
+				continue
+			case unsuccessful == nil:
+				unsuccessful = res.resp
+			default:
+				res.resp.Body.Close()
+			}
+			// The request failed, so the next backend is tried now.
+			if sent < len(backends) {
+				go send(backends[sent])
+				sent++
+			}
+
+		case <-timer.C:
+			if sent < len(backends) {
+				go send(backends[sent])
+				sent++
+				timer.Reset(delay)
+			}
+		}
+	}
+
+	// Abandon the requests which are still in flight, and close the
+	// bodies of any responses to them.
+	cancel()
+	if pending := sent - received; pending > 0 {
+		go func() {
+			for i := 0; i < pending; i++ {
+				if res := <-results; res.resp != nil {
+					res.resp.Body.Close()
+				}
+			}
+		}()
+	}
+
+	switch {
+	case winner != nil:
+		if unsuccessful != nil {
+			unsuccessful.Body.Close()
+		}
+		return winner, nil
+	case unsuccessful != nil:
+		return unsuccessful, nil
+	default:
+		return nil, errors.Join(errs...)
+	}
+}
@@ -0,0 +1,120 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestSendFirst(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	backend := func(name string, delay time.Duration, code int) {
+		h.AddBackend(name, fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+			time.Sleep(delay)
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(code)
+			w.Write([]byte(name + ":" + string(body)))
+		}))
+	}
+	backend("slow", 500*time.Millisecond, fsthttp.StatusOK)
+	backend("fast", 0, fsthttp.StatusOK)
+	backend("broken", 0, fsthttp.StatusInternalServerError)
+	backend("refused", 0, fsthttp.StatusOK)
+	h.FailBackend("refused", fsthttp.SendErrorConnectionRefused, -1)
+
+	for _, tt := range []struct {
+		name        string
+		backends    []string
+		opts        *fsthttp.SendFirstOptions
+		wantBackend string
+		wantCode    int
+		wantErr     bool
+	}{
+		{
+			name:        "hedged",
+			backends:    []string{"slow", "fast"},
+			opts:        &fsthttp.SendFirstOptions{HedgeDelay: 10 * time.Millisecond},
+			wantBackend: "fast",
+			wantCode:    fsthttp.StatusOK,
+		},
+		{
+			name:        "first wins",
+			backends:    []string{"fast", "slow"},
+			wantBackend: "fast",
+			wantCode:    fsthttp.StatusOK,
+		},
+		{
+			name:        "failure sends next at once",
+			backends:    []string{"refused", "broken", "fast"},
+			opts:        &fsthttp.SendFirstOptions{HedgeDelay: time.Minute},
+			wantBackend: "fast",
+			wantCode:    fsthttp.StatusOK,
+		},
+		{
+			name:        "race",
+			backends:    []string{"slow", "fast"},
+			opts:        &fsthttp.SendFirstOptions{HedgeDelay: -1},
+			wantBackend: "fast",
+			wantCode:    fsthttp.StatusOK,
+		},
+		{
+			name:        "unsuccessful",
+			backends:    []string{"refused", "broken"},
+			wantBackend: "broken",
+			wantCode:    fsthttp.StatusInternalServerError,
+		},
+		{
+			name:     "all fail",
+			backends: []string{"refused", "refused"},
+			wantErr:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := fsthttp.NewRequest("POST", "https://example.com/", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := fsthttp.SendFirst(context.Background(), req, tt.backends, tt.opts)
+			if tt.wantErr {
+				var se fsthttp.SendError
+				if !errors.As(err, &se) || se.Cause() != fsthttp.SendErrorConnectionRefused {
+					t.Errorf("SendFirst error = %v, want connection refused", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendFirst: %v", err)
+			}
+			defer resp.Body.Close()
+			if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+				t.Errorf("SendFirst took %v, want it not to wait for the slow backend", elapsed)
+			}
+
+			if resp.Backend != tt.wantBackend {
+				t.Errorf("Backend = %q, want %q", resp.Backend, tt.wantBackend)
+			}
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if got, want := string(body), tt.wantBackend+":payload"; got != want {
+				t.Errorf("body = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fsthttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ServeMux is an HTTP request multiplexer. It matches the URL of each
+// incoming request against a list of registered patterns and calls the
+// handler for the pattern that most closely matches the URL.
+//
+// Patterns use the same syntax as the net/http ServeMux in Go 1.22 and later:
+//
+//	[METHOD ][HOST]/[PATH]
+//
+// A pattern with a method matches only requests with that method, except
+// that GET patterns also match HEAD requests. A pattern with a host matches
+// only requests for that host. A path can include wildcard segments of the
+// form {NAME} or {NAME...}, whose matched values are available from
+// [Request.PathValue]. A path ending in a slash matches all paths with that
+// prefix, unless it ends in {$}, which matches only the path itself.
+//
+// If two or more patterns match a request, the most specific pattern takes
+// precedence, and patterns with a host take precedence over those without.
+// Registering two patterns which match the same requests, where neither is
+// more specific, panics.
+//
+// If a path matches a pattern but the method does not, the ServeMux replies
+// with 405 Method Not Allowed and an Allow header listing the methods which
+// would match. Requests for paths which are not clean are redirected to the
+// clean path, as are requests for a directory without its trailing slash.
+//
+// Unlike the net/http ServeMux, a ServeMux can be used with
+// [ServeMany] and [Serve] without importing net/http.
+type ServeMux struct {
+	mu       sync.RWMutex
+	patterns []*muxEntry
+}
+
+type muxEntry struct {
+	pat     *pattern
+	handler Handler
+}
+
+// NewServeMux allocates and returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{}
+}
+
+// Handle registers the handler for the given pattern. If the pattern is
+// invalid or conflicts with one already registered, Handle panics.
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	if err := mux.register(pattern, handler); err != nil {
+		panic(err)
+	}
+}
+
+// HandleFunc registers the handler function for the given pattern. If the
+// pattern is invalid or conflicts with one already registered, HandleFunc
+// panics.
+func (mux *ServeMux) HandleFunc(pattern string, handler func(ctx context.Context, w ResponseWriter, r *Request)) {
+	if handler == nil {
+		panic("fsthttp: nil handler")
+	}
+	mux.Handle(pattern, HandlerFunc(handler))
+}
+
+func (mux *ServeMux) register(patstr string, handler Handler) error {
+	if handler == nil {
+		return fmt.Errorf("fsthttp: nil handler for pattern %q", patstr)
+	}
+	pat, err := parsePattern(patstr)
+	if err != nil {
+		return fmt.Errorf("fsthttp: parsing %q: %w", patstr, err)
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	for _, e := range mux.patterns {
+		if pat.conflictsWith(e.pat) {
+			return fmt.Errorf("fsthttp: pattern %q conflicts with pattern %q", pat, e.pat)
+		}
+	}
+	mux.patterns = append(mux.patterns, &muxEntry{pat: pat, handler: handler})
+	return nil
+}
+
+// ServeHTTP dispatches the request to the handler whose pattern most
+// closely matches the request.
+func (mux *ServeMux) ServeHTTP(ctx context.Context, w ResponseWriter, r *Request) {
+	h, pat, matches := mux.findHandler(r)
+	if pat != nil {
+		r.Pattern = pat.str
+		r.pathValues = make(map[string]string, len(matches))
+		i := 0
+		for _, seg := range pat.segments {
+			if seg.wild && seg.s != "" {
+				r.pathValues[seg.s] = matches[i]
+			}
+			if seg.wild {
+				i++
+			}
+		}
+	}
+	h.ServeHTTP(ctx, w, r)
+}
+
+// Handler returns the handler to use for the given request, and the pattern
+// that matches it. If there is no matching pattern, it returns a handler
+// which replies with an error or a redirect, and an empty pattern.
+func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	h, pat, _ := mux.findHandler(r)
+	if pat == nil {
+		return h, ""
+	}
+	return h, pat.str
+}
+
+func (mux *ServeMux) findHandler(r *Request) (Handler, *pattern, []string) {
+	host := stripHostPort(r.Host)
+	if host == "" && r.URL != nil {
+		host = stripHostPort(r.URL.Host)
+	}
+
+	escapedPath := "/"
+	if r.URL != nil {
+		escapedPath = r.URL.EscapedPath()
+	}
+	if escapedPath == "" || escapedPath[0] != '/' {
+		escapedPath = "/" + escapedPath
+	}
+
+	if r.Method != MethodConnect {
+		if clean := cleanPath(escapedPath); clean != escapedPath {
+			return redirectHandler(r, clean), nil, nil
+		}
+	}
+
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	e, matches := mux.match(r.Method, host, escapedPath)
+
+	// If the path is a directory without its trailing slash, and the
+	// directory is registered, redirect to it.
+	if !exactMatch(e, escapedPath) && !strings.HasSuffix(escapedPath, "/") {
+		if e2, _ := mux.match(r.Method, host, escapedPath+"/"); exactMatch(e2, escapedPath+"/") {
+			return redirectHandler(r, escapedPath+"/"), nil, nil
+		}
+	}
+
+	if e != nil {
+		return e.handler, e.pat, matches
+	}
+
+	if allow := mux.allowedMethods(host, escapedPath); len(allow) > 0 {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			Error(w, StatusText(StatusMethodNotAllowed), StatusMethodNotAllowed)
+		}), nil, nil
+	}
+
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		NotFound(w, r)
+	}), nil, nil
+}
+
+// match returns the most specific pattern which matches the request, and
+// the values of its wildcards. The caller must hold mux.mu.
+func (mux *ServeMux) match(method, host, escapedPath string) (*muxEntry, []string) {
+	var (
+		best        *muxEntry
+		bestMatches []string
+	)
+	for _, e := range mux.patterns {
+		if e.pat.host != "" && e.pat.host != host {
+			continue
+		}
+		if !e.pat.matchMethod(method) {
+			continue
+		}
+		matches, ok := e.pat.matchPath(escapedPath)
+		if !ok {
+			continue
+		}
+		if best == nil || higherPrecedence(e.pat, best.pat) {
+			best, bestMatches = e, matches
+		}
+	}
+	return best, bestMatches
+}
+
+// exactMatch reports whether e's pattern matches the path exactly, rather
+// than as a prefix.
+func exactMatch(e *muxEntry, path string) bool {
+	if e == nil {
+		return false
+	}
+	if !e.pat.lastSegment().multi {
+		return true
+	}
+	// The pattern "/dir/" matches "/dir/" exactly, but not "/dir/file".
+	if !strings.HasSuffix(path, "/") {
+		return false
+	}
+	return len(e.pat.segments) == strings.Count(path, "/")
+}
+
+// higherPrecedence reports whether p1 takes precedence over p2, when both
+// match a request.
+func higherPrecedence(p1, p2 *pattern) bool {
+	if (p1.host != "") != (p2.host != "") {
+		return p1.host != ""
+	}
+	return p1.comparePathsAndMethods(p2) == moreSpecific
+}
+
+// allowedMethods returns the methods of the patterns which match the path,
+// for the Allow header of a 405 response. The caller must hold mux.mu.
+func (mux *ServeMux) allowedMethods(host, escapedPath string) []string {
+	var allow []string
+	for _, e := range mux.patterns {
+		if e.pat.host != "" && e.pat.host != host {
+			continue
+		}
+		if _, ok := e.pat.matchPath(escapedPath); !ok {
+			continue
+		}
+		if e.pat.method == "" {
+			// Any method would match, so the method is not at fault.
+			return nil
+		}
+		allow = append(allow, e.pat.method)
+		if e.pat.method == MethodGet {
+			allow = append(allow, MethodHead)
+		}
+	}
+	slices.Sort(allow)
+	return slices.Compact(allow)
+}
+
+func redirectHandler(r *Request, escapedPath string) Handler {
+	u := &url.URL{Path: pathUnescape(escapedPath), RawPath: escapedPath}
+	if r.URL != nil {
+		u.RawQuery = r.URL.RawQuery
+	}
+	target := u.String()
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Header().Set("Location", target)
+		w.WriteHeader(StatusMovedPermanently)
+	})
+}
+
+// cleanPath returns the canonical path for p, eliminating . and .. elements.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	// path.Clean removes trailing slash except for root;
+	// put the trailing slash back if necessary.
+	if p[len(p)-1] == '/' && np != "/" {
+		// Fast path for common case of p being the string we want:
+		if len(p) == len(np)+1 && strings.HasPrefix(p, np) {
+			np = p
+		} else {
+			np += "/"
+		}
+	}
+	return np
+}
+
+// stripHostPort returns h without any trailing ":<port>".
+func stripHostPort(h string) string {
+	// If no port on host, return unchanged
+	if !strings.Contains(h, ":") {
+		return h
+	}
+	host, _, err := net.SplitHostPort(h)
+	if err != nil {
+		return h // on error, return unchanged
+	}
+	return host
+}
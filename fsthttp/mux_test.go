@@ -0,0 +1,160 @@
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestServeMux(t *testing.T) {
+	t.Parallel()
+
+	mux := fsthttp.NewServeMux()
+	for _, pattern := range []string{
+		"/",
+		"GET /items/{id}",
+		"DELETE /items/{id}",
+		"GET /items/new",
+		"/static/{path...}",
+		"/exact/{$}",
+		"/dir/",
+		"api.example.com/",
+		"GET api.example.com/items/{id}",
+	} {
+		mux.HandleFunc(pattern, func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+			fmt.Fprintf(w, "%s id=%s path=%s", r.Pattern, r.PathValue("id"), r.PathValue("path"))
+		})
+	}
+
+	for _, tt := range []struct {
+		method, url string
+		code        int
+		body        string
+		header      string // Allow or Location
+	}{
+		{"GET", "https://example.com/", 200, "/ id= path=", ""},
+		{"GET", "https://example.com/anything", 200, "/ id= path=", ""},
+		{"GET", "https://example.com/items/42", 200, "GET /items/{id} id=42 path=", ""},
+		{"HEAD", "https://example.com/items/42", 200, "GET /items/{id} id=42 path=", ""},
+		{"DELETE", "https://example.com/items/42", 200, "DELETE /items/{id} id=42 path=", ""},
+		{"GET", "https://example.com/items/new", 200, "GET /items/new id= path=", ""},
+		{"GET", "https://example.com/items/a%2Fb", 200, "GET /items/{id} id=a/b path=", ""},
+		{"GET", "https://example.com/static/css/site.css", 200, "/static/{path...} id= path=css/site.css", ""},
+		{"GET", "https://example.com/static/", 200, "/static/{path...} id= path=", ""},
+		{"GET", "https://example.com/exact/", 200, "/exact/{$} id= path=", ""},
+		{"GET", "https://example.com/exact/more", 200, "/ id= path=", ""},
+		{"GET", "https://example.com/dir", 301, "", "/dir/"},
+		{"GET", "https://example.com/dir/../items/42?q=1", 301, "", "/items/42?q=1"},
+		{"GET", "https://api.example.com/items/42", 200, "GET api.example.com/items/{id} id=42 path=", ""},
+		{"GET", "https://api.example.com:443/other", 200, "api.example.com/ id= path=", ""},
+	} {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			r, err := fsthttp.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := fsttest.NewRecorder()
+			mux.ServeHTTP(context.Background(), w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("code = %d, want %d", w.Code, tt.code)
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			var header string
+			switch tt.code {
+			case 301:
+				header = w.HeaderMap.Get("Location")
+			case 405:
+				header = w.HeaderMap.Get("Allow")
+			}
+			if header != tt.header {
+				t.Errorf("header = %q, want %q", header, tt.header)
+			}
+		})
+	}
+}
+
+func TestServeMuxNoMatch(t *testing.T) {
+	t.Parallel()
+
+	mux := fsthttp.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {})
+	mux.HandleFunc("DELETE /items/{id}", func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {})
+
+	for _, tt := range []struct {
+		method, url string
+		code        int
+		allow       string
+	}{
+		{"GET", "https://example.com/other", fsthttp.StatusNotFound, ""},
+		{"POST", "https://example.com/items/42", fsthttp.StatusMethodNotAllowed, "DELETE, GET, HEAD"},
+	} {
+		r, err := fsthttp.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := fsttest.NewRecorder()
+		mux.ServeHTTP(context.Background(), w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: code = %d, want %d", tt.method, tt.url, w.Code, tt.code)
+		}
+		if got := w.HeaderMap.Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.url, got, tt.allow)
+		}
+	}
+}
+
+func TestServeMuxInvalidPatterns(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		existing, pattern string
+	}{
+		{"", ""},
+		{"", "items"},
+		{"", "/items/{id"},
+		{"", "/items/{}"},
+		{"", "/items/{id}/{id}"},
+		{"", "/items/{path...}/more"},
+		{"", "/items/{$}/more"},
+		{"", "/items/x{id}"},
+		{"", "GET /a/../b"},
+		{"/items/{id}", "/items/{name}"},
+		{"/items/{id}/a", "/items/b/{id}"},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			mux := fsthttp.NewServeMux()
+			h := fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {})
+			if tt.existing != "" {
+				mux.Handle(tt.existing, h)
+			}
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle(%q) did not panic", tt.pattern)
+				}
+			}()
+			mux.Handle(tt.pattern, h)
+		})
+	}
+}
+
+func TestRequestSetPathValue(t *testing.T) {
+	t.Parallel()
+
+	r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetPathValue("id", "7")
+	if got := r.Clone().PathValue("id"); got != "7" {
+		t.Errorf("PathValue = %q, want %q", got, "7")
+	}
+}
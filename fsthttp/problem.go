@@ -0,0 +1,308 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProblemContentType is the media type of problem details in JSON.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error which describes an HTTP API error with the problem
+// details of RFC 9457. It is written to the client with WriteProblem.
+type Problem struct {
+	// Type is a URI reference identifying the problem type. If empty,
+	// "about:blank" is used, which indicates that the problem has no
+	// semantics beyond those of the status code.
+	Type string
+
+	// Title is a short summary of the problem type. If empty, and Type is
+	// empty or "about:blank", the text of the status code is used.
+	Title string
+
+	// Status is the HTTP status code. If zero, 500 is used.
+	Status int
+
+	// Detail is an explanation of this occurrence of the problem.
+	Detail string
+
+	// Instance is a URI reference identifying this occurrence of the
+	// problem.
+	Instance string
+
+	// Extensions holds additional members of the problem details object.
+	// Members with the names of the standard members are ignored.
+	Extensions map[string]any
+
+	// Err is the underlying error, if any. It is returned by Unwrap, and
+	// is not sent to the client.
+	Err error
+}
+
+// NewProblem returns a Problem with the given status code and detail, and
+// no specific type.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Status: status, Detail: detail}
+}
+
+// Error implements error.
+func (p *Problem) Error() string {
+	s := strconv.Itoa(p.status()) + " " + p.title()
+	if p.Detail != "" {
+		s += ": " + p.Detail
+	}
+	return "fsthttp: " + s
+}
+
+// Unwrap returns the underlying error.
+func (p *Problem) Unwrap() error {
+	return p.Err
+}
+
+func (p *Problem) status() int {
+	if p.Status == 0 {
+		return StatusInternalServerError
+	}
+	return p.Status
+}
+
+func (p *Problem) typ() string {
+	if p.Type == "" {
+		return "about:blank"
+	}
+	return p.Type
+}
+
+func (p *Problem) title() string {
+	if p.Title == "" && p.typ() == "about:blank" {
+		return StatusText(p.status())
+	}
+	return p.Title
+}
+
+// MarshalJSON implements json.Marshaler, encoding p as a problem details
+// object with the extension members alongside the standard ones.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	member := func(k string, v any) error {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		kv, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		vv, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("problem member %q: %w", k, err)
+		}
+		b.Write(kv)
+		b.WriteByte(':')
+		b.Write(vv)
+		return nil
+	}
+
+	member("type", p.typ())
+	if t := p.title(); t != "" {
+		member("title", t)
+	}
+	member("status", p.status())
+	if p.Detail != "" {
+		member("detail", p.Detail)
+	}
+	if p.Instance != "" {
+		member("instance", p.Instance)
+	}
+
+	keys := make([]string, 0, len(p.Extensions))
+	for k := range p.Extensions {
+		switch k {
+		case "type", "title", "status", "detail", "instance":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := member(k, p.Extensions[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// ProblemFromError returns a Problem describing err.
+//
+// If err wraps a *Problem, it is returned. Errors returned by the SDK are
+// mapped to a status code:
+//
+//   - SendError timeouts to 504 Gateway Timeout, unavailable or refused
+//     backends to 503 Service Unavailable, and other backend failures to
+//     502 Bad Gateway. The cause is included in the "cause" extension.
+//   - ErrBackendNotFound to 502 Bad Gateway.
+//   - context.DeadlineExceeded to 504 Gateway Timeout.
+//   - *MaxBytesError to 413 Request Entity Too Large.
+//   - Errors registered with RegisterProblemStatus to their status.
+//   - Errors with an HTTPStatus() int method to the status it returns.
+//
+// Any other error is mapped to 500 Internal Server Error. The text of err
+// is not included in the problem, so that internal details are not exposed
+// to clients.
+func ProblemFromError(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	p = &Problem{Status: StatusInternalServerError, Err: err}
+
+	var se SendError
+	var mbe *MaxBytesError
+	var hs interface{ HTTPStatus() int }
+	registered := registeredProblemStatus(err)
+	switch {
+	case errors.As(err, &se):
+		p.Status = sendErrorStatus(se.Cause())
+		p.Detail = "The backend request failed."
+		p.Extensions = map[string]any{"cause": se.String()}
+	case errors.Is(err, ErrBackendNotFound):
+		p.Status = StatusBadGateway
+		p.Detail = "The backend does not exist."
+	case errors.Is(err, context.DeadlineExceeded):
+		p.Status = StatusGatewayTimeout
+	case errors.As(err, &mbe):
+		p.Status = StatusRequestEntityTooLarge
+		p.Detail = fmt.Sprintf("The request body is larger than %d bytes.", mbe.Limit)
+	case registered != 0:
+		p.Status = registered
+	case errors.As(err, &hs):
+		p.Status = hs.HTTPStatus()
+	}
+	return p
+}
+
+var problemStatuses struct {
+	mu       sync.RWMutex
+	statuses []problemStatus
+}
+
+type problemStatus struct {
+	target error
+	status int
+}
+
+// RegisterProblemStatus makes ProblemFromError map errors which match
+// target, as reported by errors.Is, to the status code. Errors from other
+// packages, such as kvstore, are otherwise reported as 500 Internal Server
+// Error, since whether they are the client's concern depends on how the
+// handler uses them:
+//
+//	func init() {
+//		fsthttp.RegisterProblemStatus(kvstore.ErrKeyNotFound, fsthttp.StatusNotFound)
+//	}
+//
+// Targets are matched in the order in which they were registered.
+func RegisterProblemStatus(target error, status int) {
+	problemStatuses.mu.Lock()
+	defer problemStatuses.mu.Unlock()
+	problemStatuses.statuses = append(problemStatuses.statuses, problemStatus{target, status})
+}
+
+// registeredProblemStatus returns the status registered for err, or 0 if
+// none is.
+func registeredProblemStatus(err error) int {
+	problemStatuses.mu.RLock()
+	defer problemStatuses.mu.RUnlock()
+	for _, ps := range problemStatuses.statuses {
+		if errors.Is(err, ps.target) {
+			return ps.status
+		}
+	}
+	return 0
+}
+
+// sendErrorStatus returns the status code for a backend request which
+// failed with the given cause.
+func sendErrorStatus(cause SendErrorCause) int {
+	switch cause {
+	case SendErrorDNSTimeout, SendErrorConnectionTimeout, SendErrorHTTPResponseTimeout:
+		return StatusGatewayTimeout
+	case SendErrorDestinationUnavailable, SendErrorConnectionRefused, SendErrorConnectionLimitReached:
+		return StatusServiceUnavailable
+	case SendErrorHTTPRequestCacheKeyInvalid, SendErrorHTTPRequestURIInvalid, SendErrorInternalError:
+		return StatusInternalServerError
+	}
+	return StatusBadGateway
+}
+
+// WriteProblem replies to the request with the problem describing err, as
+// returned by ProblemFromError. The problem is written as
+// application/problem+json, unless the Accept header of r prefers plain
+// text, in which case its title and detail are written as with Error.
+// Like Error, it does not otherwise end the request.
+func WriteProblem(w ResponseWriter, r *Request, err error) {
+	p := ProblemFromError(err)
+	if r != nil && prefersText(r.Header.Get("Accept")) {
+		msg := p.title()
+		if p.Detail != "" {
+			msg += ": " + p.Detail
+		}
+		Error(w, msg, p.status())
+		return
+	}
+	p.writeJSON(w)
+}
+
+// writeJSON writes p to w as application/problem+json.
+func (p *Problem) writeJSON(w ResponseWriter) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		// An extension could not be encoded; send the standard members.
+		body, _ = json.Marshal(&Problem{Type: p.Type, Title: p.Title, Status: p.Status, Detail: p.Detail, Instance: p.Instance})
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.status())
+	w.Write(append(body, '\n'))
+}
+
+// prefersText reports whether the Accept header value accept gives plain
+// text a higher quality than JSON. An empty header accepts anything, and
+// so gets JSON.
+func prefersText(accept string) bool {
+	var jsonQ, textQ float64
+	for _, rng := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(rng))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mt {
+		case ProblemContentType, "application/json", "application/*":
+			jsonQ = max(jsonQ, q)
+		case "text/plain", "text/*":
+			textQ = max(textQ, q)
+		case "*/*":
+			jsonQ = max(jsonQ, q)
+			textQ = max(textQ, q)
+		}
+	}
+	return textQ > jsonQ
+}
@@ -0,0 +1,159 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+	"github.com/fastly/compute-sdk-go/kvstore"
+)
+
+func TestProblemJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		p    *fsthttp.Problem
+		want string
+	}{
+		{
+			p:    &fsthttp.Problem{},
+			want: `{"type":"about:blank","title":"Internal Server Error","status":500}`,
+		},
+		{
+			p:    fsthttp.NewProblem(fsthttp.StatusNotFound, "No such widget."),
+			want: `{"type":"about:blank","title":"Not Found","status":404,"detail":"No such widget."}`,
+		},
+		{
+			p: &fsthttp.Problem{
+				Type:       "https://example.com/probs/out-of-credit",
+				Status:     fsthttp.StatusForbidden,
+				Instance:   "/account/12345/msgs/abc",
+				Extensions: map[string]any{"balance": 30, "accounts": []string{"/account/12345"}, "status": 200},
+			},
+			want: `{"type":"https://example.com/probs/out-of-credit","status":403,"instance":"/account/12345/msgs/abc","accounts":["/account/12345"],"balance":30}`,
+		},
+	} {
+		got, err := json.Marshal(tt.p)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", tt.p, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+
+	if _, err := json.Marshal(&fsthttp.Problem{Extensions: map[string]any{"f": func() {}}}); err == nil {
+		t.Errorf("Marshal with unencodable extension succeeded")
+	}
+}
+
+func TestProblemFromError(t *testing.T) {
+	t.Parallel()
+
+	custom := fsthttp.NewProblem(fsthttp.StatusConflict, "Already exists.")
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{errors.New("boom"), fsthttp.StatusInternalServerError},
+		{fmt.Errorf("create: %w", custom), fsthttp.StatusConflict},
+		{fsthttp.SendError{Tag: fsthttp.SendErrorConnectionTimeout}, fsthttp.StatusGatewayTimeout},
+		{fmt.Errorf("send: %w", fsthttp.SendError{Tag: fsthttp.SendErrorConnectionRefused}), fsthttp.StatusServiceUnavailable},
+		{fsthttp.SendError{Tag: fsthttp.SendErrorTLSCertificateError}, fsthttp.StatusBadGateway},
+		{fsthttp.ErrBackendNotFound, fsthttp.StatusBadGateway},
+		{context.DeadlineExceeded, fsthttp.StatusGatewayTimeout},
+		{&fsthttp.MaxBytesError{Limit: 10}, fsthttp.StatusRequestEntityTooLarge},
+		{httpStatusError(fsthttp.StatusTeapot), fsthttp.StatusTeapot},
+		{fmt.Errorf("brew: %w", httpStatusError(fsthttp.StatusTeapot)), fsthttp.StatusTeapot},
+		// Errors from other packages are not the client's concern
+		// unless registered.
+		{kvstore.ErrKeyNotFound, fsthttp.StatusInternalServerError},
+		{kvstore.ErrTooManyRequests, fsthttp.StatusInternalServerError},
+	} {
+		p := fsthttp.ProblemFromError(tt.err)
+		if p.Status != tt.want {
+			t.Errorf("ProblemFromError(%v).Status = %d, want %d", tt.err, p.Status, tt.want)
+		}
+		if p != custom && !errors.Is(p, tt.err) {
+			t.Errorf("ProblemFromError(%v) does not wrap the error", tt.err)
+		}
+	}
+
+	p := fsthttp.ProblemFromError(fsthttp.SendError{Tag: fsthttp.SendErrorConnectionRefused})
+	if p.Extensions["cause"] != "connection refused" {
+		t.Errorf("SendError problem extensions = %v, want cause", p.Extensions)
+	}
+}
+
+// httpStatusError is an error with an HTTPStatus method.
+type httpStatusError int
+
+func (e httpStatusError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e httpStatusError) HTTPStatus() int { return int(e) }
+
+func TestRegisterProblemStatus(t *testing.T) {
+	errFull := errors.New("quota: full")
+	errGone := errors.New("quota: gone")
+	fsthttp.RegisterProblemStatus(errFull, fsthttp.StatusTooManyRequests)
+	fsthttp.RegisterProblemStatus(errGone, fsthttp.StatusGone)
+	fsthttp.RegisterProblemStatus(errGone, fsthttp.StatusNotFound)
+
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{errFull, fsthttp.StatusTooManyRequests},
+		{fmt.Errorf("insert: %w", errFull), fsthttp.StatusTooManyRequests},
+		{errGone, fsthttp.StatusGone},
+		{errors.New("quota: full"), fsthttp.StatusInternalServerError},
+	} {
+		if got := fsthttp.ProblemFromError(tt.err).Status; got != tt.want {
+			t.Errorf("ProblemFromError(%v).Status = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		accept   string
+		wantType string
+		wantBody string
+	}{
+		{"", "application/problem+json", `{"type":"about:blank","title":"Not Found","status":404,"detail":"No such widget."}` + "\n"},
+		{"application/json", "application/problem+json", `{"type":"about:blank","title":"Not Found","status":404,"detail":"No such widget."}` + "\n"},
+		{"text/html,*/*;q=0.8", "application/problem+json", `{"type":"about:blank","title":"Not Found","status":404,"detail":"No such widget."}` + "\n"},
+		{"text/plain", "text/plain; charset=utf-8", "Not Found: No such widget.\n"},
+		{"application/json;q=0.5, text/*", "text/plain; charset=utf-8", "Not Found: No such widget.\n"},
+	} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/widgets/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+
+		w := fsttest.NewRecorder()
+		fsthttp.WriteProblem(w, r, fsthttp.NewProblem(fsthttp.StatusNotFound, "No such widget."))
+		if w.Code != fsthttp.StatusNotFound {
+			t.Errorf("Accept %q: status = %d, want 404", tt.accept, w.Code)
+		}
+		if ct := w.HeaderMap.Get("Content-Type"); ct != tt.wantType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", tt.accept, ct, tt.wantType)
+		}
+		if got := w.Body.String(); got != tt.wantBody {
+			t.Errorf("Accept %q: body = %q, want %q", tt.accept, got, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 Fastly, Inc.
+
+// Package proxy provides a reverse proxy handler, similar to the standard
+// library's httputil.ReverseProxy.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+// ReverseProxy is an [fsthttp.Handler] that sends each incoming request to a
+// backend, and copies the backend's response back to the client.
+//
+// Hop-by-hop headers are removed from the request and the response, and
+// the client's address is appended to the X-Forwarded-For and Forwarded
+// headers of the request. The response body is appended to the client
+// response by the host, without being copied through the program.
+type ReverseProxy struct {
+	// Backend is the name of the backend requests are sent to.
+	Backend string
+
+	// Director, if non-nil, modifies the outgoing request before it is
+	// sent. It is called after hop-by-hop headers have been removed and the
+	// forwarding headers have been added, so it can change or remove them.
+	// The outgoing request is a clone of the incoming request, sharing its
+	// body.
+	Director func(r *fsthttp.Request)
+
+	// ModifyResponse, if non-nil, modifies the backend's response before
+	// it is copied to the client. If it returns an error, ErrorHandler is
+	// called with that error.
+	//
+	// If ModifyResponse replaces the response Body, the new body is
+	// copied through the program rather than appended by the host.
+	ModifyResponse func(*fsthttp.Response) error
+
+	// ErrorHandler, if non-nil, is called when the request could not be
+	// sent to the backend, or ModifyResponse returned an error. The cause
+	// of a failed send can be found by extracting an [fsthttp.SendError]
+	// from err with errors.As.
+	//
+	// If ErrorHandler is nil, the error is logged and the client receives
+	// a 504 Gateway Timeout response for timeouts, or a 502 Bad Gateway
+	// response otherwise.
+	ErrorHandler func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request, err error)
+}
+
+// New returns a ReverseProxy which sends requests to the named backend.
+func New(backend string) *ReverseProxy {
+	return &ReverseProxy{Backend: backend}
+}
+
+// Hop-by-hop headers. These are removed when sent to the backend.
+// As of RFC 7230, hop-by-hop headers are required to appear in the
+// Connection header field. These are the headers defined by the
+// obsoleted RFC 2616 (section 13.5.1) and are used for backward
+// compatibility.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // non-standard but still sent by libcurl and rejected by e.g. google
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",      // canonicalized version of "TE"
+	"Trailer", // not Trailers per URL above; https://www.rfc-editor.org/errata_search.php?eid=4522
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ServeHTTP proxies the request to the backend.
+func (p *ReverseProxy) ServeHTTP(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+	out := r.Clone()
+	out.Body = r.Body
+
+	removeHopByHopHeaders(out.Header)
+
+	// Tell the backend we understand trailers, if the client did.
+	if headerValuesContainsToken(r.Header.Values("Te"), "trailers") {
+		out.Header.Set("Te", "trailers")
+	}
+
+	addForwardedHeaders(out, r)
+
+	if p.Director != nil {
+		p.Director(out)
+	}
+
+	resp, err := out.Send(ctx, p.Backend)
+	if err != nil {
+		p.handleError(ctx, w, r, err)
+		return
+	}
+
+	if p.ModifyResponse != nil {
+		if err := p.ModifyResponse(resp); err != nil {
+			resp.Body.Close()
+			p.handleError(ctx, w, r, err)
+			return
+		}
+	}
+
+	announcedTrailers := resp.Header.Values("Trailer")
+	removeHopByHopHeaders(resp.Header)
+
+	w.Header().Reset(resp.Header)
+	for _, t := range announcedTrailers {
+		w.Header().Add("Trailer", t)
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if _, ok := resp.Body.(*fastly.HTTPBody); ok {
+		err = w.Append(resp.Body)
+	} else {
+		_, err = io.Copy(w, resp.Body)
+		resp.Body.Close()
+	}
+	if err != nil {
+		log.Printf("proxy: error copying response body from backend %q: %v", p.Backend, err)
+		return
+	}
+
+	// Trailers may not be available once the body has been appended, so
+	// they are copied when they can be, and dropped otherwise.
+	trailers, err := resp.Trailers()
+	if err != nil {
+		return
+	}
+	announced := make(map[string]bool)
+	for _, t := range announcedTrailers {
+		for _, k := range strings.Split(t, ",") {
+			announced[fsthttp.CanonicalHeaderKey(strings.TrimSpace(k))] = true
+		}
+	}
+	for k, vs := range trailers {
+		if !announced[k] {
+			k = fsthttp.TrailerPrefix + k
+		}
+		w.Header()[k] = vs
+	}
+}
+
+func (p *ReverseProxy) handleError(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request, err error) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(ctx, w, r, err)
+		return
+	}
+	log.Printf("proxy: error proxying to backend %q: %v", p.Backend, err)
+	code := ErrorStatus(err)
+	fsthttp.Error(w, fsthttp.StatusText(code), code)
+}
+
+// ErrorStatus returns the status code a proxy should respond with when
+// sending a request to a backend failed with err: 504 Gateway Timeout if the
+// cause of the failure was a timeout, and 502 Bad Gateway otherwise.
+func ErrorStatus(err error) int {
+	var se fsthttp.SendError
+	if errors.As(err, &se) {
+		switch se.Cause() {
+		case fsthttp.SendErrorDNSTimeout,
+			fsthttp.SendErrorConnectionTimeout,
+			fsthttp.SendErrorHTTPResponseTimeout:
+			return fsthttp.StatusGatewayTimeout
+		}
+	}
+	return fsthttp.StatusBadGateway
+}
+
+// removeHopByHopHeaders removes the hop-by-hop headers, including those
+// named in the Connection header.
+func removeHopByHopHeaders(h fsthttp.Header) {
+	// RFC 7230, section 6.1: Remove headers listed in the "Connection" header.
+	for _, f := range h.Values("Connection") {
+		for _, sf := range strings.Split(f, ",") {
+			if sf = strings.TrimSpace(sf); sf != "" {
+				h.Del(sf)
+			}
+		}
+	}
+	// RFC 2616, section 13.5.1: Remove a set of known hop-by-hop headers.
+	// This behavior is superseded by the RFC 7230 Connection header, but
+	// preserve it for backwards compatibility.
+	for _, f := range hopHeaders {
+		h.Del(f)
+	}
+}
+
+// addForwardedHeaders appends the client address of the incoming request
+// in to the X-Forwarded-For and Forwarded headers of the outgoing request.
+func addForwardedHeaders(out, in *fsthttp.Request) {
+	clientIP := in.RemoteAddr
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	if clientIP == "" {
+		return
+	}
+
+	if prior := out.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		out.Header.Set("X-Forwarded-For", strings.Join(prior, ", ")+", "+clientIP)
+	} else {
+		out.Header.Set("X-Forwarded-For", clientIP)
+	}
+
+	// RFC 7239, section 6: IPv6 addresses are enclosed in brackets and
+	// quoted.
+	node := clientIP
+	if strings.Contains(node, ":") {
+		node = `"[` + node + `]"`
+	}
+	fwd := "for=" + node
+	if in.Host != "" {
+		fwd += ";host=" + quoteForwardedValue(in.Host)
+	}
+	proto := "http"
+	if in.URL != nil && in.URL.Scheme != "" {
+		proto = in.URL.Scheme
+	}
+	fwd += ";proto=" + proto
+
+	if prior := out.Header.Values("Forwarded"); len(prior) > 0 {
+		out.Header.Set("Forwarded", strings.Join(prior, ", ")+", "+fwd)
+	} else {
+		out.Header.Set("Forwarded", fwd)
+	}
+}
+
+// quoteForwardedValue quotes v if it is not a valid token, such as a host
+// with a port.
+func quoteForwardedValue(v string) string {
+	for _, c := range v {
+		if !isTokenRune(c) {
+			return `"` + strings.ReplaceAll(strings.ReplaceAll(v, `\`, `\\`), `"`, `\"`) + `"`
+		}
+	}
+	return v
+}
+
+func isTokenRune(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
+
+func headerValuesContainsToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
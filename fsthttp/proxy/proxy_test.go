@@ -0,0 +1,131 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestReverseProxy(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	var got *fsthttp.Request
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		got = r
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Origin", "yes")
+		w.WriteHeader(fsthttp.StatusAccepted)
+		w.Write(body)
+	}))
+
+	p := New("origin")
+	p.Director = func(r *fsthttp.Request) {
+		r.Header.Set("X-Director", "ran")
+	}
+	p.ModifyResponse = func(resp *fsthttp.Response) error {
+		resp.Header.Set("X-Modified", "ran")
+		return nil
+	}
+
+	r, err := fsthttp.NewRequest("POST", "https://example.com/path", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "192.0.2.1"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	r.Header.Set("Connection", "close, X-Private")
+	r.Header.Set("X-Private", "secret")
+	r.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	r.Header.Set("Te", "trailers, deflate")
+
+	w := fsttest.NewRecorder()
+	p.ServeHTTP(context.Background(), w, r)
+
+	if got == nil {
+		t.Fatal("backend not called")
+	}
+	for _, k := range []string{"Connection", "X-Private", "Proxy-Authorization"} {
+		if v := got.Header.Get(k); v != "" {
+			t.Errorf("backend request header %s = %q, want it removed", k, v)
+		}
+	}
+	for k, want := range map[string]string{
+		"X-Forwarded-For": "198.51.100.7, 192.0.2.1",
+		"Forwarded":       "for=192.0.2.1;host=example.com;proto=https",
+		"Te":              "trailers",
+		"X-Director":      "ran",
+	} {
+		if v := got.Header.Get(k); v != want {
+			t.Errorf("backend request header %s = %q, want %q", k, v, want)
+		}
+	}
+
+	if w.Code != fsthttp.StatusAccepted {
+		t.Errorf("code = %d, want %d", w.Code, fsthttp.StatusAccepted)
+	}
+	if got, want := w.Body.String(), "payload"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	for _, k := range []string{"Connection", "X-Hop", "Keep-Alive"} {
+		if v := w.HeaderMap.Get(k); v != "" {
+			t.Errorf("response header %s = %q, want it removed", k, v)
+		}
+	}
+	for k, want := range map[string]string{"X-Origin": "yes", "X-Modified": "ran"} {
+		if v := w.HeaderMap.Get(k); v != want {
+			t.Errorf("response header %s = %q, want %q", k, v, want)
+		}
+	}
+}
+
+func TestReverseProxyError(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := fsttest.NewRecorder()
+	New("missing").ServeHTTP(context.Background(), w, r)
+	if w.Code != fsthttp.StatusBadGateway {
+		t.Errorf("code = %d, want %d", w.Code, fsthttp.StatusBadGateway)
+	}
+
+	var handled error
+	p := New("missing")
+	p.ErrorHandler = func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request, err error) {
+		handled = err
+		w.WriteHeader(fsthttp.StatusServiceUnavailable)
+	}
+	w = fsttest.NewRecorder()
+	p.ServeHTTP(context.Background(), w, r)
+	if !errors.Is(handled, fsthttp.ErrBackendNotFound) {
+		t.Errorf("ErrorHandler error = %v, want %v", handled, fsthttp.ErrBackendNotFound)
+	}
+	if w.Code != fsthttp.StatusServiceUnavailable {
+		t.Errorf("code = %d, want %d", w.Code, fsthttp.StatusServiceUnavailable)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	if got := ErrorStatus(errors.New("boom")); got != fsthttp.StatusBadGateway {
+		t.Errorf("ErrorStatus = %d, want %d", got, fsthttp.StatusBadGateway)
+	}
+}
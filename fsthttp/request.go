@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"mime/multipart"
 	"net/url"
 	"os"
 	"strings"
@@ -39,7 +41,15 @@ type Request struct {
 
 	// Proto contains the HTTP protocol version used for incoming requests.
 	//
-	// These fields are ignored for outgoing requests.
+	// For outgoing requests, ProtoMajor and ProtoMinor choose the HTTP
+	// version used to send the request: 1.0, 1.1 or 2.0. Sending a
+	// request with any other version, including 3.0, fails. If ProtoMajor
+	// is zero, or the fields hold the version of the client request they
+	// were copied from, the version is chosen by the platform, as it is
+	// for requests which are forwarded without changes. A request copied
+	// from the client request therefore cannot pin the client's version:
+	// a handler serving an HTTP/2 client cannot require HTTP/2 for a
+	// clone of its request. Proto is ignored for outgoing requests.
 	Proto      string // "HTTP/1.0"
 	ProtoMajor int    // 1
 	ProtoMinor int    // 0
@@ -62,6 +72,13 @@ type Request struct {
 	// SetBody documentation for more information.
 	Body io.ReadCloser
 
+	// Trailer holds the trailers sent after the request body.
+	//
+	// It is only set for requests converted from net/http by ToHTTP, and,
+	// as with http.Request, its values are only available once Body has
+	// returned io.EOF. Adapt passes it on to the http.Request.
+	Trailer Header
+
 	// Host is the hostname parsed from the incoming request URL.
 	Host string
 
@@ -118,8 +135,39 @@ type Request struct {
 	// ImageOptimizerOptions control the image optimizer request.
 	ImageOptimizerOptions *imageopto.Options
 
+	// Pattern is the [ServeMux] pattern that matched the request. It is
+	// empty if the request was not matched by a ServeMux.
+	Pattern string
+
+	// Form contains the parsed form data, including both the URL query
+	// parameters and the PATCH, POST, or PUT form data. This field is only
+	// available after ParseForm is called.
+	Form url.Values
+
+	// PostForm contains the parsed form data from PATCH, POST or PUT body
+	// parameters. This field is only available after ParseForm is called.
+	PostForm url.Values
+
+	// MultipartForm is the parsed multipart form, including file uploads.
+	// This field is only available after ParseMultipartForm is called.
+	MultipartForm *multipart.Form
+
+	// Jar, if non-nil, supplies the cookies sent with an outgoing request,
+	// and stores the cookies set by its response. The cookies from the
+	// jar are added to any already in the Cookie header.
+	Jar *CookieJar
+
+	// pathValues holds the values of the wildcards in Pattern, and any set
+	// by SetPathValue.
+	pathValues map[string]string
+
 	sent bool // a request may only be sent once
 
+	// clientProtoMajor and clientProtoMinor are the version of the client
+	// request the request was created from, which is not used to send it.
+	clientProtoMajor int
+	clientProtoMinor int
+
 	abi        reqAbi
 	downstream reqAbi
 
@@ -254,6 +302,9 @@ func newClientRequest(abiReq *fastly.HTTPRequest, abiReqBody *fastly.HTTPBody) (
 		ServerAddr: serverAddr.String(),
 		TLSInfo:    tlsInfo,
 		downstream: reqAbi{req: abiReq, body: abiReqBody},
+
+		clientProtoMajor: major,
+		clientProtoMinor: minor,
 	}, nil
 }
 
@@ -315,6 +366,11 @@ func (req *Request) Clone() *Request {
 		SendPollIntervalFn:        req.SendPollIntervalFn,
 		DecompressResponseOptions: req.DecompressResponseOptions,
 		ManualFramingMode:         req.ManualFramingMode,
+		Pattern:                   req.Pattern,
+		Jar:                       req.Jar,
+		pathValues:                maps.Clone(req.pathValues),
+		clientProtoMajor:          req.clientProtoMajor,
+		clientProtoMinor:          req.clientProtoMinor,
 	}
 }
 
@@ -341,6 +397,23 @@ func cloneURL(u *url.URL) *url.URL {
 	}
 }
 
+// PathValue returns the value for the named path wildcard in the
+// [ServeMux] pattern that matched the request. It returns the empty string
+// if the request was not matched against a pattern or there is no such
+// wildcard in the pattern.
+func (req *Request) PathValue(name string) string {
+	return req.pathValues[name]
+}
+
+// SetPathValue sets name to value, so that subsequent calls to
+// req.PathValue(name) return value.
+func (req *Request) SetPathValue(name, value string) {
+	if req.pathValues == nil {
+		req.pathValues = make(map[string]string)
+	}
+	req.pathValues[name] = value
+}
+
 // Cookies parses and returns the HTTP cookies sent with the request.
 func (req *Request) Cookies() []*Cookie {
 	return readCookies(req.Header, "")
@@ -413,6 +486,12 @@ func (req *Request) FastlyMeta() (*FastlyMeta, error) {
 		if err != nil {
 			return nil, fmt.Errorf("get fastly key is valid: %w", err)
 		}
+
+		// The compliance region is not needed for the rest of the
+		// metadata, so failing to get it is not fatal.
+		if fastlyMeta.ComplianceRegion, err = req.ComplianceRegion(); err != nil {
+			fastlyMeta.ComplianceRegion = ComplianceRegionUnknown
+		}
 	}
 
 	req.fastlyMeta = fastlyMeta
@@ -433,6 +512,22 @@ func (req *Request) FastlyMeta() (*FastlyMeta, error) {
 // capabilities, and is recommended for most users who need to cache
 // HTTP responses.
 func (req *Request) Send(ctx context.Context, backend string) (*Response, error) {
+	if req.Jar == nil || req.sent {
+		return req.send(ctx, backend)
+	}
+
+	for _, c := range req.Jar.Cookies(req.URL) {
+		req.AddCookie(c)
+	}
+	resp, err := req.send(ctx, backend)
+	if err != nil {
+		return nil, err
+	}
+	req.Jar.SetCookies(req.URL, resp.Cookies())
+	return resp, nil
+}
+
+func (req *Request) send(ctx context.Context, backend string) (*Response, error) {
 	if req.sent {
 		return nil, fmt.Errorf("request already sent")
 	}
@@ -949,6 +1044,16 @@ func (req *Request) setABIRequestOptions() error {
 		return fmt.Errorf("set framing headers mode: %w", err)
 	}
 
+	if req.ProtoMajor != 0 && (req.ProtoMajor != req.clientProtoMajor || req.ProtoMinor != req.clientProtoMinor) {
+		v, ok := fastly.HTTPVersionFor(req.ProtoMajor, req.ProtoMinor)
+		if !ok || v == fastly.HTTPVersionH3 {
+			return fmt.Errorf("unsupported HTTP version %d.%d", req.ProtoMajor, req.ProtoMinor)
+		}
+		if err := abiReq.SetVersion(v); err != nil {
+			return fmt.Errorf("set version: %w", err)
+		}
+	}
+
 	cacheOpts := fastly.CacheOverrideOptions{
 		Pass:                 req.CacheOptions.Pass,
 		PCI:                  req.CacheOptions.PCI,
@@ -1034,7 +1139,7 @@ type CacheOptions struct {
 	SurrogateKey string
 
 	// Cache key to use in lieu of the automatically-generated cache key based on the request's
-	// properties.
+	// properties. It must be 32 bytes long; see CacheKeyBuilder.
 	OverrideKey string
 
 	// Sets a callback to be invoked if a request is going all the way to a
@@ -1178,6 +1283,13 @@ type FastlyMeta struct {
 	// This is for services to restrict authenticating PURGE requests for the readthrough cache.
 	FastlyKeyIsValid bool
 
+	// ComplianceRegion is the compliance region of the client request, or
+	// ComplianceRegionUnknown if it could not be determined. The error is
+	// returned by Request.ComplianceRegion. To choose where to handle a
+	// request, use RegionRouter.RouteRequest, which routes nowhere when
+	// the region cannot be determined.
+	ComplianceRegion ComplianceRegion
+
 	// SandboxRequests is the number of requests handled by the sandbox so far.
 	// For example, if this is were 3, it means that this is the 3rd request handled by the sandbox.
 	// This will be zero if this is not a client request.
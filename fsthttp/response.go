@@ -28,6 +28,12 @@ type Response struct {
 	// StatusCode of the response.
 	StatusCode int
 
+	// Proto is the HTTP protocol version of the response, such as
+	// "HTTP/1.1", as received from the backend.
+	Proto      string // "HTTP/1.1"
+	ProtoMajor int    // 1
+	ProtoMinor int    // 1
+
 	// Header received with the response.
 	Header Header
 
@@ -169,6 +175,12 @@ func newResponse(req *Request, backend string, abiResp *fastly.HTTPResponse, abi
 		Body:       abiBody,
 	}
 
+	// The version is informational, so the response is still returned if
+	// it cannot be read.
+	if proto, major, minor, err := abiResp.GetVersion(); err == nil {
+		r.Proto, r.ProtoMajor, r.ProtoMinor = proto, major, minor
+	}
+
 	r.abi.resp = abiResp
 	return r, nil
 }
@@ -331,6 +343,22 @@ type ResponseWriter interface {
 	Append(other io.ReadCloser) error
 }
 
+// VersionSetter is implemented by ResponseWriters which can set the HTTP
+// version of the response, such as the ResponseWriter passed to handlers
+// on Compute. Handlers check for it with a type assertion:
+//
+//	if vs, ok := w.(fsthttp.VersionSetter); ok {
+//		vs.SetVersion(1, 1)
+//	}
+type VersionSetter interface {
+	// SetVersion sets the HTTP version of the response to the client:
+	// 1.0, 1.1, 2.0 or 3.0. Other versions are ignored. If it is not
+	// called, the version is chosen by the platform.
+	//
+	// To have an effect on the response, this must be called before any call to Write() or WriteHeader().
+	SetVersion(major, minor int)
+}
+
 type responseWriter struct {
 	header            Header
 	abiResp           *fastly.HTTPResponse
@@ -338,6 +366,8 @@ type responseWriter struct {
 	wroteHeaders      bool
 	closed            bool
 	ManualFramingMode bool
+	version           fastly.HTTPVersion
+	setVersion        bool
 	sendErr           error
 	trailers          []string
 }
@@ -376,6 +406,11 @@ func (resp *responseWriter) WriteHeader(code int) {
 
 	resp.abiResp.SetFramingHeadersMode(resp.ManualFramingMode)
 	resp.abiResp.SetStatusCode(code)
+	if resp.setVersion {
+		if err := resp.abiResp.SetVersion(resp.version); err != nil {
+			println("fsthttp: error setting response version:", err)
+		}
+	}
 
 	var skip map[string]bool
 	if code == StatusEarlyHints {
@@ -513,6 +548,16 @@ func (resp *responseWriter) writeTrailers() error {
 	return nil
 }
 
+func (resp *responseWriter) SetVersion(major, minor int) {
+	v, ok := fastly.HTTPVersionFor(major, minor)
+	if !ok {
+		println("fsthttp: unsupported response version", major, minor)
+		return
+	}
+	resp.version = v
+	resp.setVersion = true
+}
+
 func (resp *responseWriter) SetManualFramingMode(mode bool) {
 	resp.ManualFramingMode = mode
 }
@@ -0,0 +1,261 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how [Request.SendWithRetry] retries a request which
+// could not be sent, or which received a response that may be different if
+// the request is repeated.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the request is sent,
+	// including the first. If zero, the request is sent at most 3 times.
+	MaxAttempts int
+
+	// Causes are the causes of a [SendError] after which the request is
+	// retried. If nil, DefaultRetryCauses is used.
+	Causes []SendErrorCause
+
+	// StatusCodes are the response status codes after which the request is
+	// retried. Requests are only retried after a response if their method
+	// is idempotent, as the backend may have acted on them. If nil,
+	// DefaultRetryStatusCodes is used.
+	StatusCodes []int
+
+	// BaseDelay is the delay before the first retry. It doubles for each
+	// further retry, up to MaxDelay. Each delay is chosen at random from
+	// between half of its value and its value, so that many clients do not
+	// retry in step. If zero, the base delay is 100ms.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between attempts. A response with a
+	// Retry-After header asking for a longer delay is not retried. If zero,
+	// the maximum delay is 2s.
+	MaxDelay time.Duration
+
+	// MaxBodySize is the largest request body, in bytes, which is buffered
+	// so that it can be sent again. A request with a larger body is sent
+	// only once. If zero, bodies of up to 1 MiB are buffered.
+	MaxBodySize int64
+}
+
+// DefaultRetryCauses are the causes of a [SendError] after which a request
+// is retried by default. In each case, the request did not reach the
+// backend, so it is safe to send again whatever its method.
+var DefaultRetryCauses = []SendErrorCause{
+	SendErrorDNSTimeout,
+	SendErrorDestinationUnavailable,
+	SendErrorConnectionRefused,
+	SendErrorConnectionTimeout,
+	SendErrorConnectionLimitReached,
+}
+
+// DefaultRetryStatusCodes are the response status codes after which a
+// request is retried by default.
+var DefaultRetryStatusCodes = []int{
+	StatusTooManyRequests,
+	StatusBadGateway,
+	StatusServiceUnavailable,
+	StatusGatewayTimeout,
+}
+
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 2 * time.Second
+	defaultRetryMaxBodySize = 1 << 20
+)
+
+// SendWithRetry sends the request to the named backend like Send, and sends
+// it again if it fails in a way the policy says can be retried. A nil policy
+// uses the default values described by RetryPolicy.
+//
+// Each attempt sends a clone of the request, with a copy of its body, which
+// is read into memory before the first attempt. The request itself is
+// considered sent, and may not be sent again.
+//
+// Between attempts, SendWithRetry waits with exponential backoff. If ctx is
+// done while waiting, SendWithRetry returns the response of the last attempt,
+// or an error wrapping both ctx.Err() and the error of the last attempt.
+func (req *Request) SendWithRetry(ctx context.Context, backend string, policy *RetryPolicy) (*Response, error) {
+	if req.sent {
+		return nil, fmt.Errorf("request already sent")
+	}
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryAttempts
+	}
+	maxBodySize := policy.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultRetryMaxBodySize
+	}
+
+	body, err := bufferBody(req, maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		// The body is too large to be replayed.
+		return req.Send(ctx, backend)
+	}
+	req.sent = true
+
+	for attempt := 1; ; attempt++ {
+		r := req.cloneForResend(body.Bytes())
+		resp, err := r.Send(ctx, backend)
+
+		retry := attempt < maxAttempts && policy.retryable(req, resp, err)
+		if !retry {
+			return resp, err
+		}
+
+		delay := policy.delay(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > policy.maxDelay() {
+					return resp, nil
+				}
+				delay = max(delay, after)
+			}
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if resp != nil {
+				return resp, nil
+			}
+			return nil, errors.Join(ctx.Err(), err)
+		case <-t.C:
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// bufferBody reads the body of req into memory, so that it can be sent
+// more than once, if it is no larger than maxSize. If the body is larger,
+// the part which was read is restored to the body of req, and bufferBody
+// returns nil.
+func bufferBody(req *Request, maxSize int64) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	if req.Body == nil {
+		return &buf, nil
+	}
+
+	orig := req.Body
+	n, err := io.Copy(&buf, io.LimitReader(orig, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if n > maxSize {
+		req.SetBody(struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buf, orig), orig})
+		return nil, nil
+	}
+	orig.Close()
+	return &buf, nil
+}
+
+// cloneForResend returns a copy of the request to be sent as one of several
+// copies, with the given body.
+func (req *Request) cloneForResend(body []byte) *Request {
+	r := req.Clone()
+	r.Host = req.Host
+	r.ServerAddr = req.ServerAddr
+	r.ImageOptimizerOptions = req.ImageOptimizerOptions
+	if len(body) > 0 {
+		r.SetBody(bytes.NewReader(body))
+	}
+	return r
+}
+
+// retryable reports whether a request which had the given result should be
+// sent again.
+func (p *RetryPolicy) retryable(req *Request, resp *Response, err error) bool {
+	if err != nil {
+		var se SendError
+		if !errors.As(err, &se) {
+			return false
+		}
+		causes := p.Causes
+		if causes == nil {
+			causes = DefaultRetryCauses
+		}
+		return slices.Contains(causes, se.Cause())
+	}
+
+	if !isIdempotent(req.Method) {
+		return false
+	}
+	codes := p.StatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	return slices.Contains(codes, resp.StatusCode)
+}
+
+// delay returns the time to wait after the given attempt.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	if d <= 0 {
+		d = defaultRetryBaseDelay
+	}
+	maxDelay := p.maxDelay()
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return defaultRetryMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or a date. See RFC 9110, section 10.2.3.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := time.Parse(TimeFormat, v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// isIdempotent reports whether requests with the given method are
+// idempotent. See RFC 9110, section 9.2.2.
+func isIdempotent(method string) bool {
+	switch method {
+	case MethodGet, MethodHead, MethodOptions, MethodTrace, MethodPut, MethodDelete:
+		return true
+	}
+	return false
+}
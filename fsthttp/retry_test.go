@@ -0,0 +1,170 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// This test file is in its own test package to avoid a circular
+// dependency between fsthttp and fsttest.
+
+package fsthttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+var fastRetries = &fsthttp.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestSendWithRetrySendError(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	var bodies []string
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Write([]byte("ok"))
+	}))
+	h.FailBackend("origin", fsthttp.SendErrorConnectionRefused, 2)
+
+	req, err := fsthttp.NewRequest("POST", "https://example.com/", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := req.SendWithRetry(context.Background(), "origin", fastRetries)
+	if err != nil {
+		t.Fatalf("SendWithRetry: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fsthttp.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fsthttp.StatusOK)
+	}
+	if len(bodies) != 1 || bodies[0] != "payload" {
+		t.Errorf("backend bodies = %q, want [payload]", bodies)
+	}
+
+	if _, err := req.Send(context.Background(), "origin"); err == nil {
+		t.Errorf("Send after SendWithRetry succeeded, want error")
+	}
+}
+
+func TestSendWithRetryNotRetryable(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+	h.FailBackend("origin", fsthttp.SendErrorTLSCertificateError, 1)
+
+	req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = req.SendWithRetry(context.Background(), "origin", fastRetries)
+	var se fsthttp.SendError
+	if !errors.As(err, &se) || se.Cause() != fsthttp.SendErrorTLSCertificateError {
+		t.Errorf("SendWithRetry error = %v, want TLS certificate error", err)
+	}
+}
+
+func TestSendWithRetryStatus(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	var attempts int
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		attempts++
+		w.WriteHeader(fsthttp.StatusServiceUnavailable)
+	}))
+
+	for _, tt := range []struct {
+		method       string
+		wantAttempts int
+	}{
+		{"GET", 3},
+		{"POST", 1},
+	} {
+		attempts = 0
+		req, err := fsthttp.NewRequest(tt.method, "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := req.SendWithRetry(context.Background(), "origin", fastRetries)
+		if err != nil {
+			t.Fatalf("%s: SendWithRetry: %v", tt.method, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != fsthttp.StatusServiceUnavailable {
+			t.Errorf("%s: status = %d, want %d", tt.method, resp.StatusCode, fsthttp.StatusServiceUnavailable)
+		}
+		if attempts != tt.wantAttempts {
+			t.Errorf("%s: attempts = %d, want %d", tt.method, attempts, tt.wantAttempts)
+		}
+	}
+}
+
+func TestSendWithRetryLargeBody(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	var body string
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	h.FailBackend("origin", fsthttp.SendErrorConnectionRefused, 1)
+
+	req, err := fsthttp.NewRequest("PUT", "https://example.com/", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := *fastRetries
+	policy.MaxBodySize = 4
+	if _, err := req.SendWithRetry(context.Background(), "origin", &policy); err == nil {
+		t.Fatalf("SendWithRetry succeeded, want the first error as the body can't be replayed")
+	}
+
+	req, err = fsthttp.NewRequest("PUT", "https://example.com/", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := req.SendWithRetry(context.Background(), "origin", &policy)
+	if err != nil {
+		t.Fatalf("SendWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if body != "0123456789" {
+		t.Errorf("backend body = %q, want %q", body, "0123456789")
+	}
+}
+
+func TestSendWithRetryContext(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {}))
+	h.FailBackend("origin", fsthttp.SendErrorConnectionTimeout, -1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = req.SendWithRetry(ctx, "origin", &fsthttp.RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Second})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendWithRetry error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	var se fsthttp.SendError
+	if !errors.As(err, &se) || se.Cause() != fsthttp.SendErrorConnectionTimeout {
+		t.Errorf("SendWithRetry error = %v, want the last send error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("SendWithRetry took %v, want it to stop when ctx is done", elapsed)
+	}
+}
@@ -33,6 +33,10 @@ import (
 //	}
 type SendError = fastly.SendErrorDetail
 
+// SendErrorCause identifies the cause of a SendError, as returned by its
+// Cause method.
+type SendErrorCause = fastly.SendErrorDetailTag
+
 const (
 	// SendErrorDNSTimeout indicates the system encountered a timeout when trying to
 	// find an IP address for the backend hostname.
@@ -0,0 +1,173 @@
+// Copyright 2022 Fastly, Inc.
+
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader reads server-sent events from an event stream, such as the body of
+// a response from a backend.
+type Reader struct {
+	s *bufio.Scanner
+}
+
+// NewReader returns a Reader which reads events from r.
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Split(scanLines)
+	return &Reader{s: s}
+}
+
+// Next returns the next event in the stream. It returns io.EOF at the end of
+// the stream. An event which is not terminated by a blank line before the
+// end of the stream is discarded, as a browser would.
+//
+// Unlike a browser, which only dispatches events with data, Next returns
+// each event with any field set, so that an event which only sets the ID or
+// the reconnection time is not lost when the stream is relayed.
+func (r *Reader) Next() (Event, error) {
+	var (
+		e       Event
+		data    strings.Builder
+		hasData bool
+		seen    bool
+	)
+	for r.s.Scan() {
+		line := r.s.Text()
+		if line == "" {
+			if !seen {
+				continue
+			}
+			e.Data = data.String()
+			return e, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch name {
+		case "event":
+			e.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if strings.Contains(value, "\x00") {
+				continue
+			}
+			e.ID = value
+		case "retry":
+			ms, err := strconv.ParseUint(value, 10, 63)
+			if err != nil {
+				continue
+			}
+			e.Retry = time.Duration(ms) * time.Millisecond
+		default:
+			continue
+		}
+		seen = true
+	}
+	if err := r.s.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// scanLines is a bufio.SplitFunc which splits lines ended by CRLF, LF, or
+// CR, as the event stream format allows.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR may be followed by an LF which hasn't been read yet.
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Relay reads events from src and sends them with w until src ends, ctx is
+// done, or a write fails. If transform is non-nil, each event is passed to
+// it, and the event it returns is sent instead, unless it returns false, in
+// which case the event is dropped. Relay returns nil at the end of src, and
+// ctx.Err() if ctx is done.
+//
+// If ctx is done, src may still be being read when Relay returns, so it
+// should be closed afterwards. To resume an upstream stream when the client
+// reconnects, forward the client's Last-Event-ID, as returned by
+// LastEventID, to the backend.
+func Relay(ctx context.Context, w *Writer, src io.Reader, transform func(Event) (Event, bool)) error {
+	type result struct {
+		e   Event
+		err error
+	}
+	events := make(chan result)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		r := NewReader(src)
+		for {
+			e, err := r.Next()
+			select {
+			case events <- result{e, err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res := <-events:
+			if res.err == io.EOF {
+				return nil
+			}
+			if res.err != nil {
+				return res.err
+			}
+			e := res.e
+			if transform != nil {
+				var ok bool
+				if e, ok = transform(e); !ok {
+					continue
+				}
+			}
+			if err := w.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 Fastly, Inc.
+
+// Package sse implements server-sent events, the text/event-stream format
+// used by the browser EventSource API.
+//
+// A [Writer] streams events to the client:
+//
+//	func handler(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+//		sw := sse.NewWriter(w)
+//		defer sw.Close()
+//		sw.Heartbeat(ctx, 15*time.Second)
+//		sw.Stream(ctx, events(sse.LastEventID(r)))
+//	}
+//
+// A [Reader] reads events from an upstream event stream, which lets a handler
+// relay, filter, or transform them with [Relay].
+package sse
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+)
+
+// ContentType is the media type of an event stream.
+const ContentType = "text/event-stream"
+
+// ErrInvalidField is returned when the ID or Event of an event contains a
+// newline, which the event stream format cannot represent.
+var ErrInvalidField = errors.New("sse: field contains a newline")
+
+// Event is a server-sent event.
+type Event struct {
+	// ID is the event ID. The client sends the ID of the last event it
+	// received in the Last-Event-ID header when it reconnects. If empty,
+	// no ID is sent.
+	ID string
+
+	// Event is the event type. If empty, the client treats the event as a
+	// "message" event.
+	Event string
+
+	// Data is the event data. It may contain newlines.
+	Data string
+
+	// Retry is the time the client should wait before reconnecting, if
+	// the connection is lost. If zero, no reconnection time is sent.
+	Retry time.Duration
+}
+
+// LastEventID returns the ID of the last event received by a client which
+// is reconnecting, from the Last-Event-ID request header, so that the
+// handler can resume the stream after that event. It returns the empty
+// string for a new connection.
+func LastEventID(r *fsthttp.Request) string {
+	return r.Header.Get("Last-Event-ID")
+}
+
+// Writer writes server-sent events to a response.
+//
+// The methods of a Writer may be called by multiple goroutines. After a
+// write fails, each method returns the same error.
+type Writer struct {
+	w fsthttp.ResponseWriter
+
+	mu     sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+// NewWriter returns a Writer which writes events to w. It sets the
+// Content-Type and Cache-Control headers of the response, which is sent
+// with the first event or comment, unless w.WriteHeader has already been
+// called.
+func NewWriter(w fsthttp.ResponseWriter) *Writer {
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-cache")
+	return &Writer{w: w, closed: make(chan struct{})}
+}
+
+// Send writes an event.
+func (sw *Writer) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrInvalidField
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		writeField(&b, "id", e.ID)
+	}
+	if e.Event != "" {
+		writeField(&b, "event", e.Event)
+	}
+	if e.Retry > 0 {
+		writeField(&b, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	if e.Data != "" || (e.ID == "" && e.Event == "" && e.Retry <= 0) {
+		data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			writeField(&b, "data", line)
+		}
+	}
+	b.WriteByte('\n')
+	return sw.write(b.String())
+}
+
+// Comment writes a comment, which the client ignores. Comments can be used
+// to keep the connection open while there are no events.
+func (sw *Writer) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(":")
+		if line != "" {
+			b.WriteString(" ")
+			b.WriteString(strings.TrimSuffix(line, "\r"))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteByte('\n')
+	return sw.write(b.String())
+}
+
+// Heartbeat writes an empty comment every interval, in a new goroutine, so
+// that clients and intermediaries do not close an idle connection. It stops
+// when ctx is done, when the Writer is closed, or when a write fails.
+func (sw *Writer) Heartbeat(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sw.closed:
+				return
+			case <-t.C:
+				if sw.write(":\n\n") != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Stream sends the events received from events until events is closed, ctx
+// is done, or a write fails. It returns nil if events was closed, and
+// ctx.Err() if ctx is done.
+func (sw *Writer) Stream(ctx context.Context, events <-chan Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := sw.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close stops the heartbeat and closes the response.
+func (sw *Writer) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	select {
+	case <-sw.closed:
+		return nil
+	default:
+	}
+	close(sw.closed)
+	return sw.w.Close()
+}
+
+func (sw *Writer) write(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.err != nil {
+		return sw.err
+	}
+	select {
+	case <-sw.closed:
+		return errors.New("sse: write to closed Writer")
+	default:
+	}
+	if _, err := sw.w.Write([]byte(s)); err != nil {
+		sw.err = err
+	}
+	return sw.err
+}
+
+func writeField(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(": ")
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 Fastly, Inc.
+
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+
+	w := fsttest.NewRecorder()
+	sw := NewWriter(w)
+	for _, e := range []Event{
+		{ID: "1", Event: "update", Data: "hello"},
+		{Data: "line 1\nline 2\r\nline 3"},
+		{Retry: 2500 * time.Millisecond},
+		{},
+	} {
+		if err := sw.Send(e); err != nil {
+			t.Fatalf("Send(%+v): %v", e, err)
+		}
+	}
+	if err := sw.Comment("note"); err != nil {
+		t.Fatalf("Comment: %v", err)
+	}
+	if err := sw.Send(Event{ID: "a\nb"}); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("Send with newline in ID error = %v, want %v", err, ErrInvalidField)
+	}
+	sw.Close()
+
+	if got := w.HeaderMap.Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	want := "id: 1\nevent: update\ndata: hello\n\n" +
+		"data: line 1\ndata: line 2\ndata: line 3\n\n" +
+		"retry: 2500\n\n" +
+		"data: \n\n" +
+		": note\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if err := sw.Send(Event{Data: "late"}); err == nil {
+		t.Errorf("Send after Close succeeded, want error")
+	}
+}
+
+func TestHeartbeatAndStream(t *testing.T) {
+	t.Parallel()
+
+	w := fsttest.NewRecorder()
+	sw := NewWriter(w)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sw.Heartbeat(ctx, 5*time.Millisecond)
+
+	events := make(chan Event, 1)
+	events <- Event{Data: "first"}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+	}()
+	if err := sw.Stream(ctx, events); !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream error = %v, want %v", err, context.Canceled)
+	}
+	sw.Close()
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "data: first\n\n") {
+		t.Errorf("body = %q, want it to start with the first event", body)
+	}
+	if !strings.Contains(body, ":\n\n") {
+		t.Errorf("body = %q, want heartbeat comments", body)
+	}
+}
+
+func TestReader(t *testing.T) {
+	t.Parallel()
+
+	stream := ": comment\r\n" +
+		"id: 1\r\nevent: update\r\ndata: a\r\ndata:b\r\n\r\n" +
+		"retry: 1000\rdata\r\r" +
+		"id: 2\nunknown: x\nretry: soon\n\n" +
+		"data: unterminated"
+	r := NewReader(strings.NewReader(stream))
+
+	var got []Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, e)
+	}
+	want := []Event{
+		{ID: "1", Event: "update", Data: "a\nb"},
+		{Retry: time.Second},
+		{ID: "2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+
+	src := "id: 1\ndata: keep\n\nid: 2\ndata: drop\n\nid: 3\ndata: upper\n\n"
+	w := fsttest.NewRecorder()
+	sw := NewWriter(w)
+	err := Relay(context.Background(), sw, strings.NewReader(src), func(e Event) (Event, bool) {
+		switch e.Data {
+		case "drop":
+			return e, false
+		case "upper":
+			e.Data = strings.ToUpper(e.Data)
+		}
+		return e, true
+	})
+	if err != nil {
+		t.Fatalf("Relay: %v", err)
+	}
+	if got, want := w.Body.String(), "id: 1\ndata: keep\n\nid: 3\ndata: UPPER\n\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	t.Parallel()
+
+	r, err := fsthttp.NewRequest("GET", "https://example.com/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := LastEventID(r); got != "" {
+		t.Errorf("LastEventID = %q, want empty", got)
+	}
+	r.Header.Set("Last-Event-ID", "42")
+	if got := LastEventID(r); got != "42" {
+		t.Errorf("LastEventID = %q, want %q", got, "42")
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// tlsVersions maps crypto/tls protocol versions to the names used for them
+// by [TLSInfo.Protocol], which follow OpenSSL.
+var tlsVersions = []struct {
+	version uint16
+	name    string
+}{
+	{tls.VersionTLS10, "TLSv1"},
+	{tls.VersionTLS11, "TLSv1.1"},
+	{tls.VersionTLS12, "TLSv1.2"},
+	{tls.VersionTLS13, "TLSv1.3"},
+}
+
+// tlsCipherSuites maps crypto/tls cipher suites to their OpenSSL names, as
+// used by [TLSInfo.CipherOpenSSLName].
+var tlsCipherSuites = []struct {
+	id   uint16
+	name string
+}{
+	// TLS 1.0 - 1.2 cipher suites.
+	{tls.TLS_RSA_WITH_RC4_128_SHA, "RC4-SHA"},
+	{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, "DES-CBC3-SHA"},
+	{tls.TLS_RSA_WITH_AES_128_CBC_SHA, "AES128-SHA"},
+	{tls.TLS_RSA_WITH_AES_256_CBC_SHA, "AES256-SHA"},
+	{tls.TLS_RSA_WITH_AES_128_CBC_SHA256, "AES128-SHA256"},
+	{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, "AES128-GCM-SHA256"},
+	{tls.TLS_RSA_WITH_AES_256_GCM_SHA384, "AES256-GCM-SHA384"},
+	{tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, "ECDHE-ECDSA-RC4-SHA"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, "ECDHE-ECDSA-AES128-SHA"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, "ECDHE-ECDSA-AES256-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA, "ECDHE-RSA-RC4-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, "ECDHE-RSA-DES-CBC3-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, "ECDHE-RSA-AES128-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, "ECDHE-RSA-AES256-SHA"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, "ECDHE-ECDSA-AES128-SHA256"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256, "ECDHE-RSA-AES128-SHA256"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, "ECDHE-RSA-AES128-GCM-SHA256"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, "ECDHE-ECDSA-AES128-GCM-SHA256"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, "ECDHE-RSA-AES256-GCM-SHA384"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, "ECDHE-ECDSA-AES256-GCM-SHA384"},
+	{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, "ECDHE-RSA-CHACHA20-POLY1305"},
+	{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, "ECDHE-ECDSA-CHACHA20-POLY1305"},
+
+	// TLS 1.3 cipher suites, which OpenSSL calls by their IANA names.
+	{tls.TLS_AES_128_GCM_SHA256, "TLS_AES_128_GCM_SHA256"},
+	{tls.TLS_AES_256_GCM_SHA384, "TLS_AES_256_GCM_SHA384"},
+	{tls.TLS_CHACHA20_POLY1305_SHA256, "TLS_CHACHA20_POLY1305_SHA256"},
+}
+
+// tlsVersionName returns the OpenSSL name of a crypto/tls protocol version,
+// or "" if it is not known.
+func tlsVersionName(version uint16) string {
+	for _, v := range tlsVersions {
+		if v.version == version {
+			return v.name
+		}
+	}
+	return ""
+}
+
+// tlsCipherSuiteName returns the OpenSSL name of a crypto/tls cipher suite,
+// or "" if it is not known.
+func tlsCipherSuiteName(id uint16) string {
+	for _, cs := range tlsCipherSuites {
+		if cs.id == id {
+			return cs.name
+		}
+	}
+	return ""
+}
+
+// tlsInfoFromConnectionState returns the TLSInfo and client certificate
+// information for a connection secured by net/http.
+//
+// The raw ClientHello, JA3 and JA4 signatures are not available from
+// crypto/tls, so they are left empty.
+func tlsInfoFromConnectionState(cs *tls.ConnectionState) (TLSInfo, *TLSClientCertificateInfo) {
+	if cs == nil {
+		return TLSInfo{}, &TLSClientCertificateInfo{}
+	}
+
+	info := TLSInfo{
+		Protocol:          tlsVersionName(cs.Version),
+		ClientSNI:         cs.ServerName,
+		CipherOpenSSLName: tlsCipherSuiteName(cs.CipherSuite),
+	}
+
+	var cert TLSClientCertificateInfo
+	if len(cs.PeerCertificates) > 0 {
+		cert.RawClientCertificate = cs.PeerCertificates[0].Raw
+		cert.VerifyResult = ClientCertificateVerifyResultUnknownCA
+		if len(cs.VerifiedChains) > 0 {
+			cert.VerifyResult = ClientCertificateVerifyResultOK
+		}
+	}
+	return info, &cert
+}
+
+// tlsVersionFromName returns the crypto/tls protocol version with the given
+// OpenSSL name.
+func tlsVersionFromName(name string) (uint16, bool) {
+	for _, v := range tlsVersions {
+		if v.name == name {
+			return v.version, true
+		}
+	}
+	return 0, false
+}
+
+// tlsCipherSuiteFromName returns the crypto/tls cipher suite with the given
+// OpenSSL name.
+func tlsCipherSuiteFromName(name string) (uint16, bool) {
+	for _, cs := range tlsCipherSuites {
+		if cs.name == name {
+			return cs.id, true
+		}
+	}
+	return 0, false
+}
+
+// connectionState returns the state of the client TLS connection of r, as
+// far as it can be reconstructed from TLSInfo, or nil if the request was not
+// received over TLS.
+//
+// The host does not report the protocol it negotiated with ALPN, so
+// NegotiatedProtocol is only set for HTTP/2 requests, which are always
+// negotiated as "h2" over TLS. The host reports whether the client
+// certificate was verified, but not the chain it was verified against, so
+// VerifiedChains is nil; use Request.TLSClientCertificateInfo for the
+// verification result.
+func connectionState(r *Request) *tls.ConnectionState {
+	if r.TLSInfo.Protocol == "" && (r.URL == nil || r.URL.Scheme != "https") {
+		return nil
+	}
+
+	cs := &tls.ConnectionState{
+		HandshakeComplete: true,
+		ServerName:        r.TLSInfo.ClientSNI,
+	}
+	cs.Version, _ = tlsVersionFromName(r.TLSInfo.Protocol)
+	cs.CipherSuite, _ = tlsCipherSuiteFromName(r.TLSInfo.CipherOpenSSLName)
+
+	if r.ProtoMajor == 2 {
+		cs.NegotiatedProtocol = "h2"
+	}
+	if cs.ServerName == "" {
+		if hello, ok := parseClientHello(r.TLSInfo.ClientHello); ok {
+			cs.ServerName = hello.serverName
+		}
+	}
+
+	if info, err := r.TLSClientCertificateInfo(); err == nil && len(info.RawClientCertificate) > 0 {
+		if cert, err := x509.ParseCertificate(info.RawClientCertificate); err == nil {
+			cs.PeerCertificates = []*x509.Certificate{cert}
+		}
+	}
+
+	return cs
+}
+
+// clientHello holds the fields of a TLS ClientHello message used by
+// connectionState.
+type clientHello struct {
+	serverName string
+}
+
+// extensionServerName is the server_name TLS extension type, from RFC 6066.
+const extensionServerName uint16 = 0
+
+// parseClientHello parses a ClientHello message, with or without its
+// handshake and record headers. See RFC 8446, section 4.1.2.
+func parseClientHello(b []byte) (clientHello, bool) {
+	var hello clientHello
+
+	s := tlsBytes(b)
+	// Skip the record header, if present: a handshake record's content
+	// type is 22.
+	if len(s) >= 5 && s[0] == 22 {
+		s = s[5:]
+	}
+	// Skip the handshake header, if present: a ClientHello's message type
+	// is 1.
+	if len(s) >= 4 && s[0] == 1 {
+		s = s[4:]
+	}
+
+	var sessionID, cipherSuites, compressionMethods, extensions tlsBytes
+	if !s.skip(2+32) || // legacy_version, random
+		!s.readPrefixed(1, &sessionID) ||
+		!s.readPrefixed(2, &cipherSuites) ||
+		!s.readPrefixed(1, &compressionMethods) {
+		return hello, false
+	}
+	if len(s) == 0 {
+		// No extensions.
+		return hello, true
+	}
+	if !s.readPrefixed(2, &extensions) {
+		return hello, false
+	}
+
+	for len(extensions) > 0 {
+		var typ uint16
+		var data tlsBytes
+		if !extensions.readUint16(&typ) || !extensions.readPrefixed(2, &data) {
+			return hello, false
+		}
+
+		if typ == extensionServerName {
+			var names tlsBytes
+			if !data.readPrefixed(2, &names) {
+				return hello, false
+			}
+			for len(names) > 0 {
+				var nameType uint8
+				var name tlsBytes
+				if !names.readUint8(&nameType) || !names.readPrefixed(2, &name) {
+					return hello, false
+				}
+				if nameType == 0 { // host_name
+					hello.serverName = string(name)
+				}
+			}
+		}
+	}
+
+	return hello, true
+}
+
+// tlsBytes is a minimal reader for the TLS presentation language.
+type tlsBytes []byte
+
+func (s *tlsBytes) skip(n int) bool {
+	if len(*s) < n {
+		return false
+	}
+	*s = (*s)[n:]
+	return true
+}
+
+func (s *tlsBytes) readUint8(v *uint8) bool {
+	if len(*s) < 1 {
+		return false
+	}
+	*v = (*s)[0]
+	*s = (*s)[1:]
+	return true
+}
+
+func (s *tlsBytes) readUint16(v *uint16) bool {
+	if len(*s) < 2 {
+		return false
+	}
+	*v = uint16((*s)[0])<<8 | uint16((*s)[1])
+	*s = (*s)[2:]
+	return true
+}
+
+// readPrefixed reads a vector whose length is given by a big-endian prefix
+// of lenLen bytes.
+func (s *tlsBytes) readPrefixed(lenLen int, out *tlsBytes) bool {
+	if len(*s) < lenLen {
+		return false
+	}
+	var n int
+	for _, c := range (*s)[:lenLen] {
+		n = n<<8 | int(c)
+	}
+	*s = (*s)[lenLen:]
+	if len(*s) < n {
+		return false
+	}
+	*out = (*s)[:n]
+	*s = (*s)[n:]
+	return true
+}
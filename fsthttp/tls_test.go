@@ -0,0 +1,142 @@
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// recordClientHello returns the first TLS record sent by a crypto/tls
+// client with the given config, which holds its ClientHello.
+func recordClientHello(t *testing.T, config *tls.Config) []byte {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go tls.Client(client, config).Handshake()
+	defer client.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, 5+(int(header[3])<<8|int(header[4])))
+	copy(record, header)
+	if _, err := io.ReadFull(server, record[5:]); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+func TestParseClientHello(t *testing.T) {
+	t.Parallel()
+
+	record := recordClientHello(t, &tls.Config{
+		ServerName: "example.com",
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+
+	for name, b := range map[string][]byte{
+		"record":    record,
+		"handshake": record[5:],
+		"message":   record[9:],
+	} {
+		hello, ok := parseClientHello(b)
+		if !ok {
+			t.Errorf("%s: parseClientHello failed", name)
+			continue
+		}
+		if got, want := hello.serverName, "example.com"; got != want {
+			t.Errorf("%s: serverName = %q, want %q", name, got, want)
+		}
+	}
+
+	if _, ok := parseClientHello(record[:40]); ok {
+		t.Errorf("parseClientHello succeeded on a truncated message")
+	}
+}
+
+func TestConnectionState(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ProtoMajor, r.ProtoMinor = 2, 0
+	r.TLSInfo = TLSInfo{
+		Protocol:          "TLSv1.2",
+		CipherOpenSSLName: "ECDHE-RSA-AES128-GCM-SHA256",
+		ClientHello: recordClientHello(t, &tls.Config{
+			ServerName: "sni.example.com",
+			NextProtos: []string{"h2", "http/1.1"},
+		})[9:],
+	}
+	r.clientCertificate = &TLSClientCertificateInfo{
+		RawClientCertificate: der,
+		VerifyResult:         ClientCertificateVerifyResultOK,
+	}
+
+	cs := connectionState(r)
+	if cs == nil {
+		t.Fatal("connectionState = nil")
+	}
+	if got, want := cs.Version, uint16(tls.VersionTLS12); got != want {
+		t.Errorf("Version = %x, want %x", got, want)
+	}
+	if got, want := cs.CipherSuite, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256; got != want {
+		t.Errorf("CipherSuite = %x, want %x", got, want)
+	}
+	if got, want := cs.ServerName, "sni.example.com"; got != want {
+		t.Errorf("ServerName = %q, want %q", got, want)
+	}
+	if got, want := cs.NegotiatedProtocol, "h2"; got != want {
+		t.Errorf("NegotiatedProtocol = %q, want %q", got, want)
+	}
+	if len(cs.PeerCertificates) != 1 || cs.PeerCertificates[0].Subject.CommonName != "client" {
+		t.Errorf("PeerCertificates = %v, want the client certificate", cs.PeerCertificates)
+	}
+	if cs.VerifiedChains != nil {
+		t.Errorf("VerifiedChains = %v, want nil", cs.VerifiedChains)
+	}
+
+	// The ALPN protocols offered by the client do not determine the
+	// negotiated protocol.
+	r.ProtoMajor, r.ProtoMinor = 1, 1
+	if got := connectionState(r).NegotiatedProtocol; got != "" {
+		t.Errorf("HTTP/1.1 NegotiatedProtocol = %q, want none", got)
+	}
+
+	plain, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs := connectionState(plain); cs != nil {
+		t.Errorf("connectionState for plain HTTP = %+v, want nil", cs)
+	}
+}
@@ -1,6 +1,7 @@
 package fsthttp
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"sync"
@@ -30,6 +31,18 @@ type Transport struct {
 	// sent to the backend.  It allows callers to set
 	// fsthttp.Request-specific fields, such as cache control options.
 	Request func(req *Request) error
+
+	// Send is an optional function which sends the request in place of
+	// fsthttp.Request.Send, choosing its own backend.  The host-to-backend
+	// mappings are not used when it is set.  It allows requests to be
+	// sent with a load balancer, such as a balancer.Balancer.
+	Send func(ctx context.Context, req *Request) (*Response, error)
+
+	// Jar, if non-nil, is set as the Jar of each fsthttp.Request, so that
+	// cookies are carried from one response to the next request.  It is
+	// separate from any Jar of the http.Client using the Transport, and
+	// only one of them should be set.
+	Jar *CookieJar
 }
 
 // NewTransport creates a new Transport instance with the given default
@@ -67,7 +80,8 @@ func (t *Transport) getBackend(host string) string {
 // The provided http.Request is adapted into an fsthttp.Request. If the
 // Transport's Request callback field is set, it is invoked so that the
 // fsthttp.Request can be modified before it is sent.  The request is
-// then sent to the backend matching the host in the URL.  The resulting
+// then sent to the backend matching the host in the URL, or with the
+// Transport's Send function, if it is set.  The resulting
 // fsthttp.Response is adapted into an http.Response and returned.
 //
 // The http.Response's Request field contains a context from which the
@@ -79,6 +93,7 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 	freq.Header = Header(req.Header.Clone())
+	freq.Jar = t.Jar
 
 	if t.Request != nil {
 		if err := t.Request(freq); err != nil {
@@ -86,7 +101,12 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	fresp, err := freq.Send(req.Context(), t.getBackend(req.URL.Host))
+	var fresp *Response
+	if t.Send != nil {
+		fresp, err = t.Send(req.Context(), freq)
+	} else {
+		fresp, err = freq.Send(req.Context(), t.getBackend(req.URL.Host))
+	}
 	if err != nil {
 		return nil, err
 	}
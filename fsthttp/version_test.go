@@ -0,0 +1,63 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsthttp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/fsttest"
+)
+
+func TestRequestVersion(t *testing.T) {
+	h := fsttest.NewHost()
+	defer h.Close()
+	var got string
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		got = r.Proto
+		if vs, ok := w.(fsthttp.VersionSetter); ok && r.ProtoMajor == 2 {
+			vs.SetVersion(2, 0)
+		}
+	}))
+
+	for _, tt := range []struct {
+		major, minor int
+		want         string
+		wantResp     string
+	}{
+		{0, 0, "HTTP/1.1", "HTTP/1.1"},
+		{1, 0, "HTTP/1.0", "HTTP/1.1"},
+		{2, 0, "HTTP/2.0", "HTTP/2.0"},
+	} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ProtoMajor, r.ProtoMinor = tt.major, tt.minor
+		resp, err := r.Send(context.Background(), "origin")
+		if err != nil {
+			t.Fatalf("Send with version %d.%d: %v", tt.major, tt.minor, err)
+		}
+		resp.Body.Close()
+		if got != tt.want {
+			t.Errorf("version %d.%d: backend received %s, want %s", tt.major, tt.minor, got, tt.want)
+		}
+		if resp.Proto != tt.wantResp {
+			t.Errorf("version %d.%d: response version = %s (%d.%d), want %s", tt.major, tt.minor, resp.Proto, resp.ProtoMajor, resp.ProtoMinor, tt.wantResp)
+		}
+	}
+
+	for _, v := range [][2]int{{1, 5}, {3, 0}} {
+		r, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ProtoMajor, r.ProtoMinor = v[0], v[1]
+		if _, err := r.Send(context.Background(), "origin"); err == nil {
+			t.Errorf("Send with version %d.%d succeeded", v[0], v[1])
+		}
+	}
+}
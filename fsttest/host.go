@@ -0,0 +1,438 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsttest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+// Host is an in-memory stand-in for the Compute platform, so that handlers
+// which send requests to backends or use config stores, secret stores, KV
+// stores, the core cache and log endpoints can be run under plain go test.
+//
+// Backends are fsthttp.Handlers, which are called in the same process for
+// every request sent to them. Readthrough caching of backend responses is not
+// performed.
+//
+// A Host replaces the platform for the whole program while it is installed,
+// so tests which use one must not run in parallel with each other.
+type Host struct {
+	mu           sync.Mutex
+	backends     map[string]*hostBackend
+	configStores map[string]map[string]string
+	secretStores map[string]map[string][]byte
+	kvStores     map[string]*fastly.KVStore
+	logs         map[string]*logEndpoint
+	cache        *fastly.Cache
+	prev         fastly.Host
+
+	// client is the client request being served by Serve, and
+	// clientResp and clientBody the response sent to it.
+	client     *fastly.DownstreamRequest
+	clientResp *fastly.HTTPResponse
+	clientBody *fastly.HTTPBody
+}
+
+type hostBackend struct {
+	handler fsthttp.Handler
+	health  fsthttp.BackendHealth
+
+	// failures is the number of requests which fail with failCause,
+	// or -1 if every request fails.
+	failures  int
+	failCause fsthttp.SendErrorCause
+}
+
+// NewHost returns a new Host, installed as the platform for the program. The
+// caller should call Close when finished, to uninstall it.
+func NewHost() *Host {
+	h := &Host{
+		backends:     make(map[string]*hostBackend),
+		configStores: make(map[string]map[string]string),
+		secretStores: make(map[string]map[string][]byte),
+		kvStores:     make(map[string]*fastly.KVStore),
+		logs:         make(map[string]*logEndpoint),
+		cache:        fastly.NewCache(),
+	}
+	h.prev = fastly.SetHost(hostcalls{h})
+	return h
+}
+
+// Close uninstalls the Host, restoring the previously installed one.
+func (h *Host) Close() {
+	fastly.SetHost(h.prev)
+}
+
+// AddBackend registers handler as the named backend. Requests sent to the
+// backend are served by handler.
+func (h *Host) AddBackend(name string, handler fsthttp.Handler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backends[name] = &hostBackend{handler: handler, health: fsthttp.BackendHealthUnknown}
+}
+
+// SetBackendHealth sets the health reported for the named backend, which must
+// have been added with AddBackend.
+func (h *Host) SetBackendHealth(name string, health fsthttp.BackendHealth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if b, ok := h.backends[name]; ok {
+		b.health = health
+	}
+}
+
+// FailBackend makes the next n requests sent to the named backend, which
+// must have been added with AddBackend, fail with a [fsthttp.SendError] with
+// the given cause, without being passed to its handler. If n is negative,
+// every request fails until FailBackend is called again; if n is zero,
+// requests are no longer failed.
+func (h *Host) FailBackend(name string, cause fsthttp.SendErrorCause, n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if b, ok := h.backends[name]; ok {
+		b.failures = n
+		b.failCause = cause
+	}
+}
+
+// AddConfigStore adds a config store with the given contents. Config stores
+// are also available as edge dictionaries.
+func (h *Host) AddConfigStore(name string, m map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	h.configStores[name] = c
+}
+
+// AddSecretStore adds a secret store with the given secrets.
+func (h *Host) AddSecretStore(name string, m map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := make(map[string][]byte, len(m))
+	for k, v := range m {
+		s[k] = []byte(v)
+	}
+	h.secretStores[name] = s
+}
+
+// AddKVStore adds a KV store with the given entries.
+func (h *Host) AddKVStore(name string, m map[string]string) error {
+	kv := fastly.NewKVStore()
+	for k, v := range m {
+		ih, err := kv.Insert(k, strings.NewReader(v), nil)
+		if err != nil {
+			return fmt.Errorf("insert %q: %w", k, err)
+		}
+		if err := kv.InsertWait(ih); err != nil {
+			return fmt.Errorf("insert %q: %w", k, err)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.kvStores[name] = kv
+	return nil
+}
+
+// Logs returns the events written to the named log endpoint, in order.
+func (h *Host) Logs(name string) []string {
+	return h.logEndpoint(name).events()
+}
+
+func (h *Host) logEndpoint(name string) *logEndpoint {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.logs[name]
+	if !ok {
+		l = &logEndpoint{}
+		h.logs[name] = l
+	}
+	return l
+}
+
+// logEndpoint records log events. Each call to Write is one event.
+type logEndpoint struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *logEndpoint) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, string(p))
+	return len(p), nil
+}
+
+func (l *logEndpoint) events() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.logs...)
+}
+
+// hostcalls adapts a Host to the interface used by the hostcalls, which is
+// kept out of the Host's exported API.
+type hostcalls struct {
+	h *Host
+}
+
+func (c hostcalls) Backend(name string) (fastly.BackendHealth, bool) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	b, ok := c.h.backends[name]
+	if !ok {
+		return 0, false
+	}
+	return fastly.BackendHealth(b.health), true
+}
+
+func (c hostcalls) ConfigStore(name string) (map[string]string, bool) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	m, ok := c.h.configStores[name]
+	return m, ok
+}
+
+func (c hostcalls) SecretStore(name string) (map[string][]byte, bool) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	m, ok := c.h.secretStores[name]
+	return m, ok
+}
+
+func (c hostcalls) KVStore(name string) (*fastly.KVStore, bool) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	kv, ok := c.h.kvStores[name]
+	return kv, ok
+}
+
+func (c hostcalls) LogEndpoint(name string) io.Writer {
+	return c.h.logEndpoint(name)
+}
+
+func (c hostcalls) Cache() *fastly.Cache {
+	return c.h.cache
+}
+
+// Send serves the request with the backend's handler, which runs in its own
+// goroutine. Send returns once the handler has written the response headers,
+// and the response body is streamed as the handler writes it.
+func (c hostcalls) Send(abiReq *fastly.HTTPRequest, abiBody *fastly.HTTPBody, backend string) (*fastly.HTTPResponse, *fastly.HTTPBody, error) {
+	c.h.mu.Lock()
+	b, ok := c.h.backends[backend]
+	if !ok {
+		c.h.mu.Unlock()
+		return nil, nil, fastly.FastlyError{Status: fastly.FastlyStatusInval}
+	}
+	var fail bool
+	if b.failures != 0 {
+		fail = true
+		if b.failures > 0 {
+			b.failures--
+		}
+	}
+	cause := b.failCause
+	c.h.mu.Unlock()
+
+	if fail {
+		return nil, nil, fastly.FastlyError{
+			Status: fastly.FastlyStatusError,
+			Detail: fastly.SendErrorDetail{Tag: cause},
+		}
+	}
+
+	req, err := backendRequest(abiReq, abiBody)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w, err := newBackendWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				w.abandon()
+				panicked <- p
+			}
+		}()
+		b.handler.ServeHTTP(context.Background(), w, req)
+		w.Close()
+	}()
+
+	select {
+	case <-w.ready:
+		return w.resp, w.body, nil
+	case p := <-panicked:
+		return nil, nil, fmt.Errorf("fsttest: backend %q panicked: %v", backend, p)
+	}
+}
+
+// backendRequest returns the request received by a backend's handler.
+func backendRequest(abiReq *fastly.HTTPRequest, abiBody *fastly.HTTPBody) (*fsthttp.Request, error) {
+	method, err := abiReq.GetMethod()
+	if err != nil {
+		return nil, fmt.Errorf("get method: %w", err)
+	}
+
+	uri, err := abiReq.GetURI()
+	if err != nil {
+		return nil, fmt.Errorf("get URI: %w", err)
+	}
+
+	var body io.Reader
+	if abiBody != nil {
+		body = abiBody
+	}
+
+	req, err := fsthttp.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Proto, req.ProtoMajor, req.ProtoMinor, err = abiReq.GetVersion()
+	if err != nil {
+		return nil, fmt.Errorf("get protocol version: %w", err)
+	}
+
+	keys := abiReq.GetHeaderNames()
+	for keys.Next() {
+		k := string(keys.Bytes())
+		vals := abiReq.GetHeaderValues(k)
+		for vals.Next() {
+			req.Header.Add(k, string(vals.Bytes()))
+		}
+		if err := vals.Err(); err != nil {
+			return nil, fmt.Errorf("read header key %q: %w", k, err)
+		}
+	}
+	if err := keys.Err(); err != nil {
+		return nil, fmt.Errorf("read header keys: %w", err)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	return req, nil
+}
+
+// backendWriter is the fsthttp.ResponseWriter given to a backend's handler.
+type backendWriter struct {
+	header       fsthttp.Header
+	resp         *fastly.HTTPResponse
+	body         *fastly.HTTPBody
+	ready        chan struct{}
+	wroteHeaders bool
+	closed       bool
+}
+
+func newBackendWriter() (*backendWriter, error) {
+	resp, err := fastly.NewHTTPResponse()
+	if err != nil {
+		return nil, err
+	}
+	body, err := fastly.NewHTTPBody()
+	if err != nil {
+		return nil, err
+	}
+	return &backendWriter{
+		header: fsthttp.NewHeader(),
+		resp:   resp,
+		body:   body,
+		ready:  make(chan struct{}),
+	}, nil
+}
+
+func (w *backendWriter) Header() fsthttp.Header {
+	return w.header
+}
+
+func (w *backendWriter) WriteHeader(code int) {
+	if w.wroteHeaders {
+		return
+	}
+	if code >= 100 && code < 200 {
+		// Informational responses are not passed on.
+		return
+	}
+	w.resp.SetStatusCode(code)
+	for k, vs := range w.header {
+		if strings.HasPrefix(k, fsthttp.TrailerPrefix) {
+			continue
+		}
+		w.resp.SetHeaderValues(k, vs)
+	}
+	w.wroteHeaders = true
+	close(w.ready)
+}
+
+func (w *backendWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write to closed response")
+	}
+	w.WriteHeader(fsthttp.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *backendWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.WriteHeader(fsthttp.StatusOK)
+	w.closed = true
+
+	declared := make(map[string]bool)
+	for _, vs := range w.header.Values("Trailer") {
+		for _, k := range strings.Split(vs, ",") {
+			declared[fsthttp.CanonicalHeaderKey(strings.TrimSpace(k))] = true
+		}
+	}
+	for k, vs := range w.header {
+		name, ok := strings.CutPrefix(k, fsthttp.TrailerPrefix)
+		if !ok && !declared[k] {
+			continue
+		}
+		for _, v := range vs {
+			w.body.TrailerAppend(name, v)
+		}
+	}
+
+	return w.body.Close()
+}
+
+func (w *backendWriter) SetManualFramingMode(bool) {}
+
+func (w *backendWriter) SetVersion(major, minor int) {
+	if v, ok := fastly.HTTPVersionFor(major, minor); ok && !w.wroteHeaders {
+		w.resp.SetVersion(v)
+	}
+}
+
+func (w *backendWriter) Append(other io.ReadCloser) error {
+	if _, ok := other.(*fastly.HTTPBody); !ok {
+		return fmt.Errorf("non-Response Body passed to ResponseWriter.Append")
+	}
+	_, err := io.Copy(w, other)
+	return err
+}
+
+// abandon ends the response body with an error, after a handler panics.
+func (w *backendWriter) abandon() {
+	w.closed = true
+	w.body.Abandon()
+}
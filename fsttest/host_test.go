@@ -0,0 +1,265 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastly/compute-sdk-go/cache/core"
+	"github.com/fastly/compute-sdk-go/configstore"
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+	"github.com/fastly/compute-sdk-go/kvstore"
+	"github.com/fastly/compute-sdk-go/purge"
+	"github.com/fastly/compute-sdk-go/rtlog"
+	"github.com/fastly/compute-sdk-go/secretstore"
+)
+
+func TestHostBackend(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	h.AddBackend("origin", fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Echo", r.Header.Get("X-Echo"))
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(fsthttp.StatusCreated)
+		w.Write(body)
+		w.Header().Set("X-Checksum", "abc")
+	}))
+
+	req, err := fsthttp.NewRequest("POST", "https://example.com/items", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Echo", "echoed")
+
+	resp, err := req.Send(context.Background(), "origin")
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got, want := resp.StatusCode, fsthttp.StatusCreated; got != want {
+		t.Errorf("StatusCode = %d, want %d", got, want)
+	}
+	for k, want := range map[string]string{"X-Method": "POST", "X-Path": "/items", "X-Echo": "echoed"} {
+		if got := resp.Header.Get(k); got != want {
+			t.Errorf("Header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(body), "hello"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	trailers, err := resp.Trailers()
+	if err != nil {
+		t.Fatalf("Trailers: %v", err)
+	}
+	if got, want := trailers.Get("X-Checksum"), "abc"; got != want {
+		t.Errorf("trailer X-Checksum = %q, want %q", got, want)
+	}
+}
+
+func TestHostBackendNotFound(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	req, err := fsthttp.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := req.Send(context.Background(), "missing"); !errors.Is(err, fsthttp.ErrBackendNotFound) {
+		t.Errorf("Send error = %v, want %v", err, fsthttp.ErrBackendNotFound)
+	}
+
+	// The host itself rejects the backend, rather than panicking.
+	_, _, err = hostcalls{h}.Send(nil, nil, "missing")
+	if status, ok := fastly.IsFastlyError(err); !ok || status != fastly.FastlyStatusInval {
+		t.Errorf("hostcalls.Send error = %v, want %v", err, fastly.FastlyStatusInval)
+	}
+}
+
+func TestHostServe(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	handler := fsthttp.HandlerFunc(func(ctx context.Context, w fsthttp.ResponseWriter, r *fsthttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Echo", r.Header.Get("X-Echo"))
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		if r.URL.Path == "/panic" {
+			w.WriteHeader(fsthttp.StatusOK)
+			w.Write(body)
+			panic("boom")
+		}
+		w.WriteHeader(fsthttp.StatusCreated)
+		w.Write(body)
+	})
+
+	req, err := fsthttp.NewRequest("POST", "https://example.com/items", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Echo", "echoed")
+
+	w, err := h.Serve(handler, nil, &ClientRequest{Request: req})
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if got, want := w.Code, fsthttp.StatusCreated; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+	for k, want := range map[string]string{"X-Method": "POST", "X-Path": "/items", "X-Echo": "echoed", "X-Remote-Addr": "127.0.0.1"} {
+		if got := w.HeaderMap.Get(k); got != want {
+			t.Errorf("Header %s = %q, want %q", k, got, want)
+		}
+	}
+	if got, want := w.Body.String(), "hello"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+
+	// After a recovered panic, the abandoned body is reported.
+	req, err = fsthttp.NewRequest("GET", "https://example.com/panic", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err = h.Serve(handler, &fsthttp.ServeOptions{RecoverPanics: true}, &ClientRequest{Request: req})
+	if err == nil {
+		t.Errorf("Serve after panic: no error for an abandoned body")
+	}
+	if w == nil || w.Code != fsthttp.StatusOK {
+		t.Errorf("Serve after panic: response = %+v, want status %d", w, fsthttp.StatusOK)
+	}
+}
+
+func TestHostStores(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	h.AddConfigStore("config", map[string]string{"greeting": "hello"})
+	h.AddSecretStore("secrets", map[string]string{"token": "s3cr3t"})
+	if err := h.AddKVStore("kv", map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := configstore.Open("config")
+	if err != nil {
+		t.Fatalf("configstore.Open: %v", err)
+	}
+	if v, err := cs.Get("greeting"); err != nil || v != "hello" {
+		t.Errorf("config Get = %q, %v; want %q", v, err, "hello")
+	}
+	if _, err := cs.Get("missing"); !errors.Is(err, configstore.ErrKeyNotFound) {
+		t.Errorf("config Get missing error = %v, want %v", err, configstore.ErrKeyNotFound)
+	}
+
+	if v, err := secretstore.Plaintext("secrets", "token"); err != nil || string(v) != "s3cr3t" {
+		t.Errorf("secret Plaintext = %q, %v; want %q", v, err, "s3cr3t")
+	}
+
+	kv, err := kvstore.Open("kv")
+	if err != nil {
+		t.Fatalf("kvstore.Open: %v", err)
+	}
+	if err := kv.Insert("c", strings.NewReader("3")); err != nil {
+		t.Fatalf("kv Insert: %v", err)
+	}
+	e, err := kv.Lookup("c")
+	if err != nil {
+		t.Fatalf("kv Lookup: %v", err)
+	}
+	if got, want := e.String(), "3"; got != want {
+		t.Errorf("kv Lookup = %q, want %q", got, want)
+	}
+	if err := kv.Delete("a"); err != nil {
+		t.Fatalf("kv Delete: %v", err)
+	}
+	if _, err := kv.Lookup("a"); !errors.Is(err, kvstore.ErrKeyNotFound) {
+		t.Errorf("kv Lookup deleted error = %v, want %v", err, kvstore.ErrKeyNotFound)
+	}
+
+	var keys []string
+	iter := kv.List(&kvstore.ListConfig{Limit: 1})
+	for iter.Next() {
+		keys = append(keys, iter.Page().Data...)
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("kv List: %v", err)
+	}
+	if got, want := strings.Join(keys, ","), "b,c"; got != want {
+		t.Errorf("kv List = %q, want %q", got, want)
+	}
+}
+
+func TestHostCache(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	key := []byte("key")
+	if _, err := core.Lookup(key, core.LookupOptions{}); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("Lookup error = %v, want %v", err, core.ErrNotFound)
+	}
+
+	tx, err := core.NewTransaction(key, core.LookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.MustInsert() {
+		t.Fatal("MustInsert = false, want true")
+	}
+	w, err := tx.Insert(core.WriteOptions{TTL: time.Minute, SurrogateKeys: []string{"sk"}})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	io.WriteString(w, "cached")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Close()
+
+	f, err := core.Lookup(key, core.LookupOptions{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	body, _ := io.ReadAll(f.Body)
+	f.Body.Close()
+	if got, want := string(body), "cached"; got != want {
+		t.Errorf("cached body = %q, want %q", got, want)
+	}
+
+	if err := purge.PurgeSurrogateKey("sk", purge.PurgeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.Lookup(key, core.LookupOptions{}); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("Lookup after purge error = %v, want %v", err, core.ErrNotFound)
+	}
+}
+
+func TestHostLogs(t *testing.T) {
+	h := NewHost()
+	defer h.Close()
+
+	rtlog.Open("access").Write([]byte("one"))
+	rtlog.Open("access").Write([]byte("two"))
+
+	if got, want := strings.Join(h.Logs("access"), ","), "one,two"; got != want {
+		t.Errorf("Logs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fsttest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
+	"github.com/fastly/compute-sdk-go/fsthttp"
+	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
+)
+
+// ClientRequest is a request from a client, served with Host.Serve.
+type ClientRequest struct {
+	// Request is the request sent by the client. Its URL must be
+	// absolute. Its Body, if any, is read before the request is served.
+	Request *fsthttp.Request
+
+	// ComplianceRegion is the compliance region of the client, returned
+	// by Request.ComplianceRegion.
+	ComplianceRegion fsthttp.ComplianceRegion
+
+	// FailComplianceRegion makes Request.ComplianceRegion return an
+	// error, as when the platform cannot determine the region.
+	FailComplianceRegion bool
+
+	// HeaderNames lists the names of the request headers in the order and
+	// case the client sent them, with a name repeated for each time the
+	// header was sent, as returned by Request.OriginalHeaderNames. If
+	// nil, it is the canonical names of the headers of Request, sorted,
+	// each repeated for each of its values.
+	HeaderNames []string
+}
+
+// Serve serves the client request r with h, through
+// fsthttp.ServeWithOptions, as the platform would serve a request to the
+// program. It returns the response sent to the client.
+//
+// If the response body was abandoned, such as after a recovered panic, the
+// returned error says so, and the recorder holds the status and headers
+// sent. A panic not recovered by opts is not recovered by Serve either.
+func (h *Host) Serve(handler fsthttp.Handler, opts *fsthttp.ServeOptions, r *ClientRequest) (*ResponseRecorder, error) {
+	d, err := downstreamRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.client = d
+	h.clientResp, h.clientBody = nil, nil
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.client = nil
+		h.mu.Unlock()
+	}()
+
+	fsthttp.ServeWithOptions(handler, opts)
+
+	h.mu.Lock()
+	resp, body := h.clientResp, h.clientBody
+	h.mu.Unlock()
+	if resp == nil {
+		return nil, fmt.Errorf("fsttest: no response sent to the client")
+	}
+	return clientResponse(resp, body)
+}
+
+// downstreamRequest returns the hostcall representation of r.
+func downstreamRequest(r *ClientRequest) (*fastly.DownstreamRequest, error) {
+	req := r.Request
+	abiReq, err := fastly.NewHTTPRequest()
+	if err != nil {
+		return nil, err
+	}
+	if err := abiReq.SetMethod(req.Method); err != nil {
+		return nil, fmt.Errorf("set method: %w", err)
+	}
+	if err := abiReq.SetURI(req.URL.String()); err != nil {
+		return nil, fmt.Errorf("set URL: %w", err)
+	}
+	if v, ok := fastly.HTTPVersionFor(req.ProtoMajor, req.ProtoMinor); ok {
+		if err := abiReq.SetVersion(v); err != nil {
+			return nil, fmt.Errorf("set version: %w", err)
+		}
+	}
+	header := req.Header.Clone()
+	if header.Get("Host") == "" {
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		header.Set("Host", host)
+	}
+	keys := header.Keys()
+	sort.Strings(keys)
+	names := r.HeaderNames
+	for _, key := range keys {
+		vals := header.Values(key)
+		if err := abiReq.SetHeaderValues(key, vals); err != nil {
+			return nil, fmt.Errorf("set headers: %w", err)
+		}
+		if r.HeaderNames == nil {
+			for range vals {
+				names = append(names, key)
+			}
+		}
+	}
+
+	abiBody, err := fastly.NewHTTPBody()
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		if _, err := io.Copy(abiBody, req.Body); err != nil {
+			return nil, fmt.Errorf("read body: %w", err)
+		}
+	}
+	if err := abiBody.Close(); err != nil {
+		return nil, err
+	}
+
+	d := &fastly.DownstreamRequest{
+		Request:             abiReq,
+		Body:                abiBody,
+		ClientIP:            net.IPv4(127, 0, 0, 1),
+		ServerIP:            net.IPv4(127, 0, 0, 1),
+		ComplianceRegion:    r.ComplianceRegion.String(),
+		OriginalHeaderNames: names,
+	}
+	if r.FailComplianceRegion {
+		d.ComplianceRegionErr = fastly.FastlyError{Status: fastly.FastlyStatusError}
+	}
+	return d, nil
+}
+
+// clientResponse records the response sent to the client.
+func clientResponse(resp *fastly.HTTPResponse, body *fastly.HTTPBody) (*ResponseRecorder, error) {
+	rec := NewRecorder()
+
+	code, err := resp.GetStatusCode()
+	if err != nil {
+		return nil, fmt.Errorf("get status code: %w", err)
+	}
+	rec.WriteHeader(code)
+
+	keys := resp.GetHeaderNames()
+	for keys.Next() {
+		k := string(keys.Bytes())
+		vals := resp.GetHeaderValues(k)
+		for vals.Next() {
+			rec.HeaderMap.Add(k, string(vals.Bytes()))
+		}
+		if err := vals.Err(); err != nil {
+			return nil, fmt.Errorf("read header key %q: %w", k, err)
+		}
+	}
+	if err := keys.Err(); err != nil {
+		return nil, fmt.Errorf("read header keys: %w", err)
+	}
+
+	if _, err := io.Copy(rec.Body, body); err != nil {
+		return rec, fmt.Errorf("fsttest: read response body: %w", err)
+	}
+	return rec, nil
+}
+
+func (c hostcalls) DownstreamRequest() (*fastly.DownstreamRequest, bool) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	return c.h.client, c.h.client != nil
+}
+
+// SendDownstream records the response sent to the client, if a client
+// request is being served.
+func (c hostcalls) SendDownstream(resp *fastly.HTTPResponse, body *fastly.HTTPBody) {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	if c.h.client != nil {
+		c.h.clientResp, c.h.clientBody = resp, body
+	}
+}
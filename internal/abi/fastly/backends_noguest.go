@@ -0,0 +1,81 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import "time"
+
+func BackendExists(name string) (bool, error) {
+	h, err := getHost()
+	if err != nil {
+		return false, err
+	}
+	_, ok := h.Backend(name)
+	return ok, nil
+}
+
+func BackendIsHealthy(name string) (BackendHealth, error) {
+	h, err := getHost()
+	if err != nil {
+		return BackendHealthUnknown, err
+	}
+	health, ok := h.Backend(name)
+	if !ok {
+		return BackendHealthUnknown, FastlyError{Status: FastlyStatusInval}
+	}
+	return health, nil
+}
+
+// backendUnset is returned by the getters for properties that a Host does
+// not model, so callers treat them as not configured.
+func backendUnset(name string) error {
+	h, err := getHost()
+	if err != nil {
+		return err
+	}
+	if _, ok := h.Backend(name); !ok {
+		return FastlyError{Status: FastlyStatusInval}
+	}
+	return FastlyError{Status: FastlyStatusNone}
+}
+
+func BackendIsDynamic(name string) (bool, error) {
+	return false, backendUnset(name)
+}
+
+func BackendGetHost(name string) (string, error) {
+	return "", backendUnset(name)
+}
+
+func BackendGetOverrideHost(name string) (string, error) {
+	return "", backendUnset(name)
+}
+
+func BackendGetPort(name string) (int, error) {
+	return 0, backendUnset(name)
+}
+
+func BackendGetConnectTimeout(name string) (time.Duration, error) {
+	return 0, backendUnset(name)
+}
+
+func BackendGetFirstByteTimeout(name string) (time.Duration, error) {
+	return 0, backendUnset(name)
+}
+
+func BackendGetBetweenBytesTimeout(name string) (time.Duration, error) {
+	return 0, backendUnset(name)
+}
+
+func BackendIsSSL(name string) (bool, error) {
+	return false, backendUnset(name)
+}
+
+func BackendGetSSLMinVersion(name string) (TLSVersion, error) {
+	return 0, backendUnset(name)
+}
+
+func BackendGetSSLMaxVersion(name string) (TLSVersion, error) {
+	return 0, backendUnset(name)
+}
@@ -0,0 +1,382 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory core cache, for use by a Host.
+//
+// Lookups are not collapsed: every transactional lookup which does not find
+// a fresh object is obliged to insert or update it. Vary rules and request
+// headers are ignored.
+type Cache struct {
+	mu      sync.Mutex
+	objects map[string]*cacheObject
+}
+
+type cacheObject struct {
+	body     []byte
+	opts     CacheWriteOptions
+	inserted time.Time
+	hits     uint64
+}
+
+// NewCache returns an empty in-memory cache, for use by a Host.
+func NewCache() *Cache {
+	return &Cache{objects: make(map[string]*cacheObject)}
+}
+
+func (o *cacheObject) age() time.Duration {
+	return o.opts.initialAge + time.Since(o.inserted)
+}
+
+// lookup returns the object stored under key, and its state. Objects which
+// are past their stale-while-revalidate period are not found.
+func (c *Cache) lookup(key string) (*cacheObject, CacheLookupState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.objects[key]
+	if !ok {
+		return nil, 0
+	}
+
+	age := obj.age()
+	switch {
+	case age < obj.opts.maxAge:
+		obj.hits++
+		return obj, CacheLookupStateFound | CacheLookupStateUsable
+	case age < obj.opts.maxAge+obj.opts.staleWhileRevalidate:
+		obj.hits++
+		return obj, CacheLookupStateFound | CacheLookupStateUsable | CacheLookupStateStale
+	default:
+		delete(c.objects, key)
+		return nil, 0
+	}
+}
+
+func (c *Cache) store(key string, obj *cacheObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[key] = obj
+}
+
+func (c *Cache) purge(surrogateKey string, soft bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, obj := range c.objects {
+		if !slices.Contains(obj.opts.surrogateKeys, surrogateKey) {
+			continue
+		}
+		if soft {
+			// Age the object to the end of its freshness.
+			obj.inserted = time.Now().Add(-obj.opts.maxAge)
+			obj.opts.initialAge = 0
+			continue
+		}
+		delete(c.objects, key)
+	}
+}
+
+func getCache() (*Cache, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	return h.Cache(), nil
+}
+
+type CacheLookupOptions struct {
+	alwaysUseRequestedRange bool
+}
+
+func (o *CacheLookupOptions) SetRequest(req *HTTPRequest) {
+}
+
+func (o *CacheLookupOptions) SetAlwaysUseRequestedRange(alwaysUseRequestedRange bool) {
+	o.alwaysUseRequestedRange = alwaysUseRequestedRange
+}
+
+type CacheGetBodyOptions struct {
+	from, to       uint64
+	hasFrom, hasTo bool
+}
+
+func (o *CacheGetBodyOptions) From(from uint64) {
+	o.from = from
+	o.hasFrom = true
+}
+
+func (o *CacheGetBodyOptions) To(to uint64) {
+	o.to = to
+	o.hasTo = true
+}
+
+type CacheWriteOptions struct {
+	maxAge               time.Duration
+	initialAge           time.Duration
+	staleWhileRevalidate time.Duration
+	vary                 []string
+	surrogateKeys        []string
+	length               uint64
+	hasLength            bool
+	userMetadata         []byte
+	sensitiveData        bool
+}
+
+func (o *CacheWriteOptions) MaxAge(v time.Duration) {
+	o.maxAge = v
+}
+
+func (o *CacheWriteOptions) SetRequest(req *HTTPRequest) {
+}
+
+func (o *CacheWriteOptions) Vary(v []string) {
+	o.vary = append([]string(nil), v...)
+}
+
+func (o *CacheWriteOptions) InitialAge(v time.Duration) {
+	o.initialAge = v
+}
+
+func (o *CacheWriteOptions) StaleWhileRevalidate(v time.Duration) {
+	o.staleWhileRevalidate = v
+}
+
+func (o *CacheWriteOptions) SurrogateKeys(v []string) {
+	o.surrogateKeys = append([]string(nil), v...)
+}
+
+func (o *CacheWriteOptions) ContentLength(v uint64) {
+	o.length = v
+	o.hasLength = true
+}
+
+func (o *CacheWriteOptions) UserMetadata(v []byte) {
+	o.userMetadata = append([]byte(nil), v...)
+}
+
+func (o *CacheWriteOptions) SensitiveData(v bool) {
+	o.sensitiveData = v
+}
+
+// CacheEntry is the result of a lookup in the in-memory cache.
+type CacheEntry struct {
+	cache       *Cache
+	key         string
+	obj         *cacheObject
+	state       CacheLookupState
+	transaction bool
+
+	// stream is the body of an object being inserted, for an entry
+	// returned by InsertAndStreamBack.
+	stream *HTTPBody
+}
+
+func CacheLookup(key []byte, opts CacheLookupOptions) (*CacheEntry, error) {
+	c, err := getCache()
+	if err != nil {
+		return nil, err
+	}
+	obj, state := c.lookup(string(key))
+	return &CacheEntry{cache: c, key: string(key), obj: obj, state: state}, nil
+}
+
+func CacheTransactionLookup(key []byte, opts CacheLookupOptions) (*CacheEntry, error) {
+	c, err := getCache()
+	if err != nil {
+		return nil, err
+	}
+	obj, state := c.lookup(string(key))
+	if obj == nil || state&CacheLookupStateStale != 0 {
+		state |= CacheLookupStateMustInsertOrUpdate
+	}
+	return &CacheEntry{cache: c, key: string(key), obj: obj, state: state, transaction: true}, nil
+}
+
+// insertBody returns a body which stores its contents under key when it is
+// closed.
+func (c *Cache) insertBody(key string, opts CacheWriteOptions) *HTTPBody {
+	return &HTTPBody{
+		onClose: func(data []byte) {
+			c.store(key, &cacheObject{
+				body:     append([]byte(nil), data...),
+				opts:     opts,
+				inserted: time.Now(),
+			})
+		},
+	}
+}
+
+func CacheInsert(key []byte, opts CacheWriteOptions) (*HTTPBody, error) {
+	c, err := getCache()
+	if err != nil {
+		return nil, err
+	}
+	return c.insertBody(string(key), opts), nil
+}
+
+func (e *CacheEntry) mustInsertOrUpdate() error {
+	if !e.transaction || e.state&CacheLookupStateMustInsertOrUpdate == 0 {
+		return FastlyError{Status: FastlyStatusBadf}
+	}
+	return nil
+}
+
+func (e *CacheEntry) Insert(opts CacheWriteOptions) (*HTTPBody, error) {
+	if err := e.mustInsertOrUpdate(); err != nil {
+		return nil, err
+	}
+	e.state &^= CacheLookupStateMustInsertOrUpdate
+	return e.cache.insertBody(e.key, opts), nil
+}
+
+func (e *CacheEntry) InsertAndStreamBack(opts CacheWriteOptions) (*HTTPBody, *CacheEntry, error) {
+	body, err := e.Insert(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	body.tee = &HTTPBody{}
+
+	found := &CacheEntry{
+		cache:  e.cache,
+		key:    e.key,
+		obj:    &cacheObject{opts: opts, inserted: time.Now()},
+		state:  CacheLookupStateFound | CacheLookupStateUsable,
+		stream: body.tee,
+	}
+	return body, found, nil
+}
+
+func (e *CacheEntry) Update(opts CacheWriteOptions) error {
+	if err := e.mustInsertOrUpdate(); err != nil {
+		return err
+	}
+	if e.obj == nil {
+		return FastlyError{Status: FastlyStatusBadf}
+	}
+	e.state &^= CacheLookupStateMustInsertOrUpdate
+	e.cache.store(e.key, &cacheObject{
+		body:     e.obj.body,
+		opts:     opts,
+		inserted: time.Now(),
+	})
+	return nil
+}
+
+func (e *CacheEntry) Cancel() error {
+	if err := e.mustInsertOrUpdate(); err != nil {
+		return err
+	}
+	e.state &^= CacheLookupStateMustInsertOrUpdate
+	return nil
+}
+
+func (c *CacheEntry) Close() error {
+	return nil
+}
+
+func (c *CacheEntry) State() (CacheLookupState, error) {
+	return c.state, nil
+}
+
+func (c *CacheEntry) found() error {
+	if c.obj == nil {
+		return FastlyError{Status: FastlyStatusNone}
+	}
+	return nil
+}
+
+func (c *CacheEntry) UserMetadata() ([]byte, error) {
+	if err := c.found(); err != nil {
+		return nil, err
+	}
+	return c.obj.opts.userMetadata, nil
+}
+
+// Body returns the object's body, or the range of it selected by opts. The
+// range is inclusive, and the whole body is returned if it is invalid.
+func (c *CacheEntry) Body(opts CacheGetBodyOptions) (*HTTPBody, error) {
+	if err := c.found(); err != nil {
+		return nil, err
+	}
+	if c.stream != nil {
+		s := c.stream
+		c.stream = nil
+		return s, nil
+	}
+
+	body := c.obj.body
+	from, to := uint64(0), uint64(len(body))
+	if opts.hasFrom {
+		from = opts.from
+	}
+	if opts.hasTo {
+		to = opts.to + 1
+	}
+	if from < to && to <= uint64(len(body)) {
+		body = body[from:to]
+	}
+	return newBodyFrom(body), nil
+}
+
+func (c *CacheEntry) Length() (uint64, error) {
+	if err := c.found(); err != nil {
+		return 0, err
+	}
+	if c.obj.body == nil && c.obj.opts.hasLength {
+		return c.obj.opts.length, nil
+	}
+	return uint64(len(c.obj.body)), nil
+}
+
+func (c *CacheEntry) MaxAge() (time.Duration, error) {
+	if err := c.found(); err != nil {
+		return 0, err
+	}
+	return c.obj.opts.maxAge, nil
+}
+
+func (c *CacheEntry) StaleWhileRevalidate() (time.Duration, error) {
+	if err := c.found(); err != nil {
+		return 0, err
+	}
+	return c.obj.opts.staleWhileRevalidate, nil
+}
+
+func (c *CacheEntry) Age() (time.Duration, error) {
+	if err := c.found(); err != nil {
+		return 0, err
+	}
+	return c.obj.age(), nil
+}
+
+func (c *CacheEntry) Hits() (uint64, error) {
+	if err := c.found(); err != nil {
+		return 0, err
+	}
+	return c.obj.hits, nil
+}
+
+type PurgeOptions struct {
+	soft bool
+}
+
+func (o *PurgeOptions) SoftPurge(v bool) {
+	o.soft = v
+}
+
+func PurgeSurrogateKey(surrogateKey string, opts PurgeOptions) error {
+	c, err := getCache()
+	if err != nil {
+		return err
+	}
+	c.purge(surrogateKey, opts.soft)
+	return nil
+}
@@ -0,0 +1,46 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+// ConfigStore is a read-only view of a config store provided by the Host.
+type ConfigStore struct {
+	m map[string]string
+}
+
+func OpenConfigStore(name string) (*ConfigStore, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, FastlyError{Status: FastlyStatusNone}
+	}
+	m, ok := h.ConfigStore(name)
+	if !ok {
+		return nil, FastlyError{Status: FastlyStatusBadf}
+	}
+	return &ConfigStore{m: m}, nil
+}
+
+func (d *ConfigStore) GetBytes(key string) ([]byte, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return nil, FastlyError{Status: FastlyStatusNone}
+	}
+	return []byte(v), nil
+}
+
+func (d *ConfigStore) Get(key string) (string, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return "", FastlyError{Status: FastlyStatusNone}
+	}
+	return v, nil
+}
+
+func (d *ConfigStore) Has(key string) (bool, error) {
+	_, ok := d.m[key]
+	return ok, nil
+}
@@ -0,0 +1,19 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+// Dictionary is a read-only view of an edge dictionary. Hosts provide
+// dictionaries as config stores.
+type Dictionary struct {
+	ConfigStore
+}
+
+func OpenDictionary(name string) (*Dictionary, error) {
+	s, err := OpenConfigStore(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Dictionary{*s}, nil
+}
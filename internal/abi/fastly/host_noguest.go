@@ -0,0 +1,179 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Host provides the parts of the Compute platform that live outside the
+// program, for builds which are not running under a Compute runtime. With no
+// Host installed, hostcalls which need the platform return "not implemented"
+// errors.
+//
+// In-memory objects such as request, response and body handles work without a
+// Host.
+type Host interface {
+	// Send handles a request sent to the named backend. The backend is
+	// known to exist.
+	Send(req *HTTPRequest, body *HTTPBody, backend string) (*HTTPResponse, *HTTPBody, error)
+
+	// Backend reports whether the named backend exists, and its health.
+	Backend(name string) (BackendHealth, bool)
+
+	// ConfigStore returns the contents of the named config store. It is
+	// also used for edge dictionaries.
+	ConfigStore(name string) (map[string]string, bool)
+
+	// SecretStore returns the contents of the named secret store.
+	SecretStore(name string) (map[string][]byte, bool)
+
+	// KVStore returns the named KV store.
+	KVStore(name string) (*KVStore, bool)
+
+	// LogEndpoint returns the writer for the named log endpoint. Each
+	// call to Write is a single log event.
+	LogEndpoint(name string) io.Writer
+
+	// Cache returns the core cache.
+	Cache() *Cache
+
+	// DownstreamRequest returns the client request being served, and
+	// whether there is one.
+	DownstreamRequest() (*DownstreamRequest, bool)
+
+	// SendDownstream receives the response sent to the client. The body
+	// is complete once it has been closed or abandoned.
+	SendDownstream(resp *HTTPResponse, body *HTTPBody)
+}
+
+// DownstreamRequest is a client request served by the program, with the
+// details the platform reports about the client.
+type DownstreamRequest struct {
+	Request *HTTPRequest
+	Body    *HTTPBody
+
+	ClientIP net.IP
+	ServerIP net.IP
+
+	// ComplianceRegion is returned by DownstreamComplianceRegion, or
+	// ComplianceRegionErr if it is set.
+	ComplianceRegion    string
+	ComplianceRegionErr error
+
+	// OriginalHeaderNames are the names of the request headers in the
+	// order and case the client sent them, with repeats.
+	OriginalHeaderNames []string
+}
+
+var (
+	hostMu sync.RWMutex
+	host   Host
+)
+
+// SetHost installs h as the Host for hostcalls, and returns the previously
+// installed Host. Passing nil removes the installed Host.
+func SetHost(h Host) Host {
+	hostMu.Lock()
+	defer hostMu.Unlock()
+	prev := host
+	host = h
+	return prev
+}
+
+func getHost() (Host, error) {
+	hostMu.RLock()
+	defer hostMu.RUnlock()
+	if host == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return host, nil
+}
+
+// headerList is an ordered, case-insensitive multimap of header fields, as
+// kept by the host for requests, responses and trailers.
+type headerList struct {
+	mu     sync.Mutex
+	fields []headerField
+}
+
+type headerField struct {
+	name   string
+	values []string
+}
+
+func (l *headerList) index(name string) int {
+	for i, f := range l.fields {
+		if strings.EqualFold(f.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *headerList) names() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, len(l.fields))
+	for i, f := range l.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+func (l *headerList) get(name string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := l.index(name); i >= 0 {
+		return append([]string(nil), l.fields[i].values...)
+	}
+	return nil
+}
+
+func (l *headerList) set(name string, values []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values = append([]string(nil), values...)
+	if i := l.index(name); i >= 0 {
+		l.fields[i].values = values
+		return
+	}
+	l.fields = append(l.fields, headerField{name: strings.ToLower(name), values: values})
+}
+
+func (l *headerList) add(name, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i := l.index(name); i >= 0 {
+		l.fields[i].values = append(l.fields[i].values, value)
+		return
+	}
+	l.fields = append(l.fields, headerField{name: strings.ToLower(name), values: []string{value}})
+}
+
+func (l *headerList) remove(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := l.index(name)
+	if i < 0 {
+		return false
+	}
+	l.fields = append(l.fields[:i], l.fields[i+1:]...)
+	return true
+}
+
+// valuesFrom returns a Values iterator over vs, without a hostcall behind it.
+func valuesFrom(vs []string) *Values {
+	var buf []byte
+	for _, v := range vs {
+		buf = append(buf, v...)
+		buf = append(buf, 0)
+	}
+	return &Values{pending: buf, finished: true}
+}
@@ -8,107 +8,73 @@ package fastly
 
 import (
 	"fmt"
-	"io"
 	"net"
 	"time"
 )
 
-type HTTPBody struct{}
-
-func (b *HTTPBody) Append(other *HTTPBody) error {
-	return fmt.Errorf("not implemented")
-}
-
-func NewHTTPBody() (*HTTPBody, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) Read(p []byte) (int, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) Write(p []byte) (n int, err error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) Close() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) Abandon() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) Length() (uint64, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) TrailerAppend(name, value string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) GetTrailerNames() *Values {
-	return nil
-}
-
-func (b *HTTPBody) GetTrailerValue(name string, maxHeaderValueLen int) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (b *HTTPBody) GetTrailerValues(name string) *Values {
-	return nil
-}
-
-type LogEndpoint struct{}
-
-func GetLogEndpoint(name string) (*LogEndpoint, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (e *LogEndpoint) Write(p []byte) (n int, err error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-type HTTPRequest struct{}
-
 func BodyDownstreamGet() (*HTTPRequest, *HTTPBody, error) {
-	return nil, nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) Close() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetCacheOverride(options CacheOverrideOptions) error {
-	return fmt.Errorf("not implemented")
+	h, err := getHost()
+	if err != nil {
+		return nil, nil, err
+	}
+	d, ok := h.DownstreamRequest()
+	if !ok {
+		return nil, nil, fmt.Errorf("not implemented")
+	}
+	d.Request.downstream = d
+	return d.Request, d.Body, nil
 }
 
 func (r *HTTPRequest) DownstreamClientIPAddr() (net.IP, error) {
-	return nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return r.downstream.ClientIP, nil
 }
 
 func (r *HTTPRequest) DownstreamServerIPAddr() (net.IP, error) {
-	return nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return r.downstream.ServerIP, nil
 }
 
+// The TLS details of a client request served by a Host are empty, as if the
+// client sent no TLS extensions.
+
 func (r *HTTPRequest) DownstreamTLSCipherOpenSSLName() (string, error) {
-	return "", fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return "", fmt.Errorf("not implemented")
+	}
+	return "", nil
 }
 
 func (r *HTTPRequest) DownstreamTLSProtocol() (string, error) {
-	return "", fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return "", fmt.Errorf("not implemented")
+	}
+	return "", nil
 }
 
 func (r *HTTPRequest) DownstreamTLSClientHello() ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return nil, nil
 }
 
 func (r *HTTPRequest) DownstreamTLSClientServername() (string, error) {
-	return "", fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return "", fmt.Errorf("not implemented")
+	}
+	return "", nil
 }
 
 func (r *HTTPRequest) DownstreamTLSJA3MD5() ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return nil, nil
 }
 
 func (r *HTTPRequest) DownstreamH2Fingerprint() ([]byte, error) {
@@ -136,11 +102,20 @@ func (r *HTTPRequest) DownstreamTLSClientCertVerifyResult() (ClientCertificateVe
 }
 
 func (r *HTTPRequest) DownstreamTLSJA4() ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return nil, fmt.Errorf("not implemented")
+	}
+	return nil, nil
 }
 
 func (r *HTTPRequest) DownstreamComplianceRegion() (string, error) {
-	return "", fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return "", fmt.Errorf("not implemented")
+	}
+	if r.downstream.ComplianceRegionErr != nil {
+		return "", r.downstream.ComplianceRegionErr
+	}
+	return r.downstream.ComplianceRegion, nil
 }
 
 func (r *HTTPRequest) DownstreamFastlyKeyIsValid() (bool, error) {
@@ -215,116 +190,28 @@ func (r *HTTPRequest) DownstreamResVPNProxyVPNServiceName() (string, error) {
 	return "", fmt.Errorf("not implemented")
 }
 
-func NewHTTPRequest() (*HTTPRequest, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetHeaderNames() *Values {
-	return nil
-}
-
 func (r *HTTPRequest) DownstreamOriginalHeaderNames() *Values {
-	return nil
+	if r.downstream == nil {
+		return nil
+	}
+	return valuesFrom(r.downstream.OriginalHeaderNames)
 }
 
 func (r *HTTPRequest) DownstreamOriginalHeaderCount() (int, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetHeaderValue(name string, maxHeaderValueLen int) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetHeaderValues(name string) *Values {
-	return nil
-}
-
-func (r *HTTPRequest) SetHeaderValues(name string, values []string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) InsertHeader(name, value string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) AppendHeader(name, value string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) RemoveHeader(name string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetMethod() (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetMethod(method string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetURI() (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetURI(uri string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) GetVersion() (proto string, major, minor int, err error) {
-	return "", 0, 0, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetVersion(v HTTPVersion) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) Send(requestBody *HTTPBody, backend string) (response *HTTPResponse, responseBody *HTTPBody, err error) {
-	return nil, nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SendV3(requestBody *HTTPBody, backend string) (response *HTTPResponse, responseBody *HTTPBody, err error) {
-	return nil, nil, fmt.Errorf("not implemented")
+	if r.downstream == nil {
+		return 0, fmt.Errorf("not implemented")
+	}
+	return len(r.downstream.OriginalHeaderNames), nil
 }
 
 func (r *HTTPRequest) Inspect(info *InspectInfo, b *HTTPBody) ([]byte, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-type PendingRequest struct{}
-
-func (r *HTTPRequest) SendAsync(requestBody *HTTPBody, backend string) (*PendingRequest, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SendAsyncV2(requestBody *HTTPBody, backend string, streaming bool) (*PendingRequest, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SendAsyncStreaming(requestBody *HTTPBody, backend string) (*PendingRequest, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
 func (r *HTTPRequest) SendToImageOpto(requestBody *HTTPBody, backend, query string) (response *HTTPResponse, responseBody *HTTPBody, err error) {
 	return nil, nil, fmt.Errorf("not implemented")
 }
 
-func (r *PendingRequest) Poll() (done bool, response *HTTPResponse, responseBody *HTTPBody, err error) {
-	return false, nil, nil, fmt.Errorf("not implemented")
-}
-
-func (r *PendingRequest) Wait() (response *HTTPResponse, responseBody *HTTPBody, err error) {
-	return nil, nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetAutoDecompressResponse(options AutoDecompressResponseOptions) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPRequest) SetFramingHeadersMode(manual bool) error {
-	return fmt.Errorf("not implemented")
-}
-
 func (r *HTTPRequest) HandoffWebsocket(backend string) error {
 	return fmt.Errorf("not implemented")
 }
@@ -347,12 +234,8 @@ func (HTTPRequestPromise) Abandon() error {
 	return fmt.Errorf("not implemented")
 }
 
-func (r *HTTPResponse) GetAddrDestIP() (net.IP, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) GetAddrDestPort() (uint16, error) {
-	return 0, fmt.Errorf("not implemented")
+func (HTTPRequestPromise) IsReady() (bool, error) {
+	return false, fmt.Errorf("not implemented")
 }
 
 func HandoffWebsocket(backend string) error {
@@ -367,353 +250,10 @@ func RegisterDynamicBackend(name string, target string, opts *BackendConfigOptio
 	return fmt.Errorf("not implemented")
 }
 
-func BackendExists(name string) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
-func BackendIsHealthy(name string) (BackendHealth, error) {
-	return BackendHealthUnknown, fmt.Errorf("not implemented")
-}
-
-func BackendIsDynamic(name string) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
-func BackendGetHost(name string) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func BackendGetOverrideHost(name string) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func BackendGetPort(name string) (int, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func BackendGetConnectTimeout(name string) (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func BackendGetFirstByteTimeout(name string) (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func BackendGetBetweenBytesTimeout(name string) (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func BackendIsSSL(name string) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
-func BackendGetSSLMinVersion(name string) (TLSVersion, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func BackendGetSSLMaxVersion(name string) (TLSVersion, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-type HTTPResponse struct{}
-
-func NewHTTPResponse() (*HTTPResponse, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) Close() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) GetHeaderNames() *Values {
-	return nil
-}
-
-func (r *HTTPResponse) GetHeaderValue(name string) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) GetHeaderValues(name string) *Values {
-	return nil
-}
-
-func (r *HTTPResponse) SetHeaderValues(name string, values []string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) InsertHeader(name, value string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) AppendHeader(name, value string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) RemoveHeader(name string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) GetVersion() (proto string, major, minor int, err error) {
-	return "", 0, 0, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) SetVersion(v HTTPVersion) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) SendDownstream(responseBody *HTTPBody, stream bool) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) GetStatusCode() (int, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) SetStatusCode(code int) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (r *HTTPResponse) SetFramingHeadersMode(manual bool) error {
-	return fmt.Errorf("not implemented")
-}
-
-type Dictionary struct{}
-
-func OpenDictionary(name string) (*Dictionary, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (d *Dictionary) GetBytes(key string) ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (d *Dictionary) Get(key string) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (d *Dictionary) Has(key string) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
-type ConfigStore struct{}
-
-func OpenConfigStore(name string) (*ConfigStore, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (d *ConfigStore) GetBytes(key string) ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (d *ConfigStore) Get(key string) (string, error) {
-	return "", fmt.Errorf("not implemented")
-}
-
-func (d *ConfigStore) Has(key string) (bool, error) {
-	return false, fmt.Errorf("not implemented")
-}
-
 func GeoLookup(ip net.IP) ([]byte, error) {
 	return nil, fmt.Errorf("not implemented")
 }
 
-
-type KVStore struct{}
-
-func OpenKVStore(name string) (*KVStore, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) Lookup(key string) (kvstoreLookupHandle, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) LookupWait(h kvstoreLookupHandle) (KVLookupResult, error) {
-	return KVLookupResult{}, fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) Insert(key string, value io.Reader, config *KVInsertConfig) (kvstoreInsertHandle, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) InsertWait(h kvstoreInsertHandle) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) Delete(key string) (kvstoreDeleteHandle, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (o *KVStore) DeleteWait(h kvstoreDeleteHandle) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (kv *KVStore) List(config *KVListConfig) (kvstoreListHandle, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (kv *KVStore) ListWait(listH kvstoreListHandle) (*HTTPBody, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-type (
-	SecretStore struct{}
-	Secret      struct{}
-)
-
-func OpenSecretStore(name string) (*SecretStore, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (s *SecretStore) Get(name string) (*Secret, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (s *Secret) Plaintext() ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (s *Secret) Handle() secretHandle {
-	return 0
-}
-
-func SecretFromBytes(b []byte) (*Secret, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-type (
-	CacheEntry          struct{}
-	CacheLookupOptions  struct{}
-	CacheGetBodyOptions struct{}
-	CacheWriteOptions   struct{}
-)
-
-func (o *CacheLookupOptions) SetRequest(req *HTTPRequest) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheLookupOptions) SetAlwaysUseRequestedRange(alwaysUseRequestedRange bool) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheGetBodyOptions) From(from uint64) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheGetBodyOptions) To(to uint64) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) MaxAge(v time.Duration) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) SetRequest(req *HTTPRequest) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) Vary(v []string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) InitialAge(v time.Duration) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) StaleWhileRevalidate(v time.Duration) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) SurrogateKeys(v []string) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) ContentLength(v uint64) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) UserMetadata(v []byte) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (o *CacheWriteOptions) SensitiveData(v bool) error {
-	return fmt.Errorf("not implemented")
-}
-
-func CacheLookup(key []byte, opts CacheLookupOptions) (*CacheEntry, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func CacheInsert(key []byte, opts CacheWriteOptions) (*HTTPBody, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func CacheTransactionLookup(key []byte, opts CacheLookupOptions) (*CacheEntry, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (e *CacheEntry) Insert(opts CacheWriteOptions) (*HTTPBody, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (e *CacheEntry) InsertAndStreamBack(opts CacheWriteOptions) (*HTTPBody, *CacheEntry, error) {
-	return nil, nil, fmt.Errorf("not implemented")
-}
-
-func (e *CacheEntry) Update(opts CacheWriteOptions) error {
-	return fmt.Errorf("not implemented")
-}
-
-func (e *CacheEntry) Cancel() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) Close() error {
-	return fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) State() (CacheLookupState, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) UserMetadata() ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) Body(opts CacheGetBodyOptions) (*HTTPBody, error) {
-	return nil, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) Length() (uint64, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) MaxAge() (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) StaleWhileRevalidate() (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) Age() (time.Duration, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-func (c *CacheEntry) Hits() (uint64, error) {
-	return 0, fmt.Errorf("not implemented")
-}
-
-type PurgeOptions struct{}
-
-func (o *PurgeOptions) SoftPurge(v bool) error {
-	return fmt.Errorf("not implemented")
-}
-
-func PurgeSurrogateKey(surrogateKey string, opts PurgeOptions) error {
-	return fmt.Errorf("not implemented")
-}
-
 func DeviceLookup(userAgent string) ([]byte, error) {
 	return nil, fmt.Errorf("not implemented")
 }
@@ -768,7 +308,6 @@ func (HTTPCacheLookupOptions) OverrideKey(key string) {
 func (HTTPCacheLookupOptions) Backend(backend string) {
 }
 
-
 func HTTPCacheIsRequestCacheable(req *HTTPRequest) (bool, error) {
 	return false, fmt.Errorf("not implemented")
 }
@@ -1215,6 +1215,36 @@ func (p *HTTPRequestPromise) Abandon() error {
 	return nil
 }
 
+// witx:
+//
+//	(module $fastly_async_io
+//	  ;;; Returns 1 if the given async item is "ready" for its associated I/O action, 0 otherwise.
+//	  (@interface func (export "is_ready")
+//	    (param $handle $async_item_handle)
+//	    (result $err (expected $is_done (error $fastly_status)))
+//	  )
+//	)
+//
+//go:wasmimport fastly_async_io is_ready
+//go:noescape
+func fastlyAsyncIOIsReady(
+	h handle,
+	ready prim.Pointer[prim.U32],
+) FastlyStatus
+
+// IsReady reports whether Wait would return without blocking, either
+// because the next request has arrived or because the promise has failed.
+func (p *HTTPRequestPromise) IsReady() (bool, error) {
+	var ready prim.U32
+	if err := fastlyAsyncIOIsReady(
+		handle(p.h),
+		prim.ToPointer(&ready),
+	).toError(); err != nil {
+		return false, err
+	}
+	return ready == 1, nil
+}
+
 // witx:
 //
 //	(@interface func (export "downstream_original_header_names")
@@ -0,0 +1,457 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// HTTPBody is an in-memory HTTP body. Writes are buffered until read, and
+// reads block until data is written or the body is closed, so a body can be
+// streamed between goroutines.
+type HTTPBody struct {
+	mu        sync.Mutex
+	cond      sync.Cond
+	buf       []byte
+	closed    bool
+	abandoned bool
+	trailers  headerList
+
+	// tee receives a copy of everything written to the body.
+	tee *HTTPBody
+
+	// onClose is called with the complete contents of a body that is
+	// closed without being read, such as a cache insertion.
+	onClose func(data []byte)
+}
+
+// newBodyFrom returns a closed body holding a copy of data.
+func newBodyFrom(data []byte) *HTTPBody {
+	return &HTTPBody{buf: append([]byte(nil), data...), closed: true}
+}
+
+func (b *HTTPBody) wait() {
+	if b.cond.L == nil {
+		b.cond.L = &b.mu
+	}
+	b.cond.Wait()
+}
+
+func (b *HTTPBody) broadcast() {
+	if b.cond.L == nil {
+		b.cond.L = &b.mu
+	}
+	b.cond.Broadcast()
+}
+
+// Append reads the whole of other and appends it to the body.
+func (b *HTTPBody) Append(other *HTTPBody) error {
+	data, err := io.ReadAll(other)
+	if err != nil {
+		return err
+	}
+	if _, err := b.Write(data); err != nil {
+		return err
+	}
+	return other.Close()
+}
+
+func NewHTTPBody() (*HTTPBody, error) {
+	return &HTTPBody{}, nil
+}
+
+func (b *HTTPBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.buf) == 0 && !b.closed {
+		b.wait()
+	}
+	if b.abandoned {
+		return 0, FastlyError{Status: FastlyStatusHTTPIncomplete}
+	}
+	if len(b.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *HTTPBody) Write(p []byte) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, FastlyError{Status: FastlyStatusBadf}
+	}
+	b.buf = append(b.buf, p...)
+	if b.tee != nil {
+		b.tee.Write(p)
+	}
+	b.broadcast()
+	return len(p), nil
+}
+
+func (b *HTTPBody) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.broadcast()
+	onClose, data, tee := b.onClose, b.buf, b.tee
+	b.mu.Unlock()
+
+	if onClose != nil {
+		onClose(data)
+	}
+	if tee != nil {
+		tee.Close()
+	}
+	return nil
+}
+
+func (b *HTTPBody) Abandon() error {
+	b.mu.Lock()
+	b.closed = true
+	b.abandoned = true
+	b.onClose = nil
+	b.broadcast()
+	tee := b.tee
+	b.mu.Unlock()
+
+	if tee != nil {
+		tee.Abandon()
+	}
+	return nil
+}
+
+// Length returns the size of the body once it has been completely written.
+func (b *HTTPBody) Length() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		return 0, FastlyError{Status: FastlyStatusNone}
+	}
+	return uint64(len(b.buf)), nil
+}
+
+func (b *HTTPBody) TrailerAppend(name, value string) error {
+	b.trailers.add(name, value)
+	return nil
+}
+
+// GetTrailerNames returns the trailer names, which are only available once
+// the body has been closed.
+func (b *HTTPBody) GetTrailerNames() *Values {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if !closed {
+		return &Values{err: FastlyError{Status: FastlyStatusAgain}}
+	}
+	return valuesFrom(b.trailers.names())
+}
+
+func (b *HTTPBody) GetTrailerValue(name string, maxHeaderValueLen int) (string, error) {
+	vs := b.trailers.get(name)
+	if len(vs) == 0 {
+		return "", FastlyError{Status: FastlyStatusNone}
+	}
+	return vs[0], nil
+}
+
+func (b *HTTPBody) GetTrailerValues(name string) *Values {
+	return valuesFrom(b.trailers.get(name))
+}
+
+// HTTPRequest is an in-memory HTTP request.
+type HTTPRequest struct {
+	method  string
+	uri     string
+	version HTTPVersion
+	header  headerList
+
+	cacheOverride  CacheOverrideOptions
+	autoDecompress AutoDecompressResponseOptions
+	manualFraming  bool
+	closed         bool
+
+	// downstream is set on the client request returned by
+	// BodyDownstreamGet.
+	downstream *DownstreamRequest
+}
+
+func NewHTTPRequest() (*HTTPRequest, error) {
+	return &HTTPRequest{method: "GET", version: HTTPVersionHTTP11}, nil
+}
+
+func (r *HTTPRequest) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *HTTPRequest) SetCacheOverride(options CacheOverrideOptions) error {
+	r.cacheOverride = options
+	return nil
+}
+
+func (r *HTTPRequest) GetHeaderNames() *Values {
+	return valuesFrom(r.header.names())
+}
+
+func (r *HTTPRequest) GetHeaderValue(name string, maxHeaderValueLen int) (string, error) {
+	vs := r.header.get(name)
+	if len(vs) == 0 {
+		return "", FastlyError{Status: FastlyStatusNone}
+	}
+	return vs[0], nil
+}
+
+func (r *HTTPRequest) GetHeaderValues(name string) *Values {
+	return valuesFrom(r.header.get(name))
+}
+
+func (r *HTTPRequest) SetHeaderValues(name string, values []string) error {
+	r.header.set(name, values)
+	return nil
+}
+
+func (r *HTTPRequest) InsertHeader(name, value string) error {
+	r.header.set(name, []string{value})
+	return nil
+}
+
+func (r *HTTPRequest) AppendHeader(name, value string) error {
+	r.header.add(name, value)
+	return nil
+}
+
+func (r *HTTPRequest) RemoveHeader(name string) error {
+	if !r.header.remove(name) {
+		return FastlyError{Status: FastlyStatusInval}
+	}
+	return nil
+}
+
+func (r *HTTPRequest) GetMethod() (string, error) {
+	return r.method, nil
+}
+
+func (r *HTTPRequest) SetMethod(method string) error {
+	r.method = method
+	return nil
+}
+
+func (r *HTTPRequest) GetURI() (string, error) {
+	return r.uri, nil
+}
+
+func (r *HTTPRequest) SetURI(uri string) error {
+	r.uri = uri
+	return nil
+}
+
+func (r *HTTPRequest) GetVersion() (proto string, major, minor int, err error) {
+	return r.version.splat()
+}
+
+func (r *HTTPRequest) SetVersion(v HTTPVersion) error {
+	r.version = v
+	return nil
+}
+
+func (r *HTTPRequest) SetAutoDecompressResponse(options AutoDecompressResponseOptions) error {
+	r.autoDecompress = options
+	return nil
+}
+
+func (r *HTTPRequest) SetFramingHeadersMode(manual bool) error {
+	r.manualFraming = manual
+	return nil
+}
+
+func sendToHost(r *HTTPRequest, requestBody *HTTPBody, backend string) (*HTTPResponse, *HTTPBody, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := h.Backend(backend); !ok {
+		return nil, nil, FastlyError{Status: FastlyStatusInval}
+	}
+	return h.Send(r, requestBody, backend)
+}
+
+func (r *HTTPRequest) Send(requestBody *HTTPBody, backend string) (response *HTTPResponse, responseBody *HTTPBody, err error) {
+	return sendToHost(r, requestBody, backend)
+}
+
+func (r *HTTPRequest) SendV3(requestBody *HTTPBody, backend string) (response *HTTPResponse, responseBody *HTTPBody, err error) {
+	return sendToHost(r, requestBody, backend)
+}
+
+// PendingRequest is a request being handled by the Host in the background.
+type PendingRequest struct {
+	done chan struct{}
+	resp *HTTPResponse
+	body *HTTPBody
+	err  error
+}
+
+func (r *HTTPRequest) SendAsync(requestBody *HTTPBody, backend string) (*PendingRequest, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := h.Backend(backend); !ok {
+		return nil, FastlyError{Status: FastlyStatusInval}
+	}
+
+	p := &PendingRequest{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.resp, p.body, p.err = h.Send(r, requestBody, backend)
+	}()
+	return p, nil
+}
+
+func (r *HTTPRequest) SendAsyncV2(requestBody *HTTPBody, backend string, streaming bool) (*PendingRequest, error) {
+	return r.SendAsync(requestBody, backend)
+}
+
+func (r *HTTPRequest) SendAsyncStreaming(requestBody *HTTPBody, backend string) (*PendingRequest, error) {
+	return r.SendAsync(requestBody, backend)
+}
+
+func (r *PendingRequest) Poll() (done bool, response *HTTPResponse, responseBody *HTTPBody, err error) {
+	select {
+	case <-r.done:
+		return true, r.resp, r.body, r.err
+	default:
+		return false, nil, nil, nil
+	}
+}
+
+func (r *PendingRequest) Wait() (response *HTTPResponse, responseBody *HTTPBody, err error) {
+	<-r.done
+	return r.resp, r.body, r.err
+}
+
+// HTTPResponse is an in-memory HTTP response.
+type HTTPResponse struct {
+	status        int
+	version       HTTPVersion
+	header        headerList
+	manualFraming bool
+	destIP        net.IP
+	destPort      uint16
+	sent          bool
+}
+
+func NewHTTPResponse() (*HTTPResponse, error) {
+	return &HTTPResponse{status: 200, version: HTTPVersionHTTP11}, nil
+}
+
+func (r *HTTPResponse) Close() error {
+	return nil
+}
+
+func (r *HTTPResponse) GetHeaderNames() *Values {
+	return valuesFrom(r.header.names())
+}
+
+func (r *HTTPResponse) GetHeaderValue(name string) (string, error) {
+	vs := r.header.get(name)
+	if len(vs) == 0 {
+		return "", FastlyError{Status: FastlyStatusNone}
+	}
+	return vs[0], nil
+}
+
+func (r *HTTPResponse) GetHeaderValues(name string) *Values {
+	return valuesFrom(r.header.get(name))
+}
+
+func (r *HTTPResponse) SetHeaderValues(name string, values []string) error {
+	r.header.set(name, values)
+	return nil
+}
+
+func (r *HTTPResponse) InsertHeader(name, value string) error {
+	r.header.set(name, []string{value})
+	return nil
+}
+
+func (r *HTTPResponse) AppendHeader(name, value string) error {
+	r.header.add(name, value)
+	return nil
+}
+
+func (r *HTTPResponse) RemoveHeader(name string) error {
+	if !r.header.remove(name) {
+		return FastlyError{Status: FastlyStatusInval}
+	}
+	return nil
+}
+
+func (r *HTTPResponse) GetVersion() (proto string, major, minor int, err error) {
+	return r.version.splat()
+}
+
+func (r *HTTPResponse) SetVersion(v HTTPVersion) error {
+	r.version = v
+	return nil
+}
+
+// SendDownstream marks the response as sent, and passes it to the installed
+// Host. Without a Host to send it to, the body is discarded.
+func (r *HTTPResponse) SendDownstream(responseBody *HTTPBody, stream bool) error {
+	if r.status >= 100 && r.status < 200 && r.status != 103 {
+		return FastlyError{Status: FastlyStatusInval}
+	}
+	if r.sent {
+		return FastlyError{Status: FastlyStatusBadf}
+	}
+	if r.status != 103 {
+		r.sent = true
+		if h, err := getHost(); err == nil {
+			h.SendDownstream(r, responseBody)
+		}
+	}
+	return nil
+}
+
+func (r *HTTPResponse) GetStatusCode() (int, error) {
+	return r.status, nil
+}
+
+func (r *HTTPResponse) SetStatusCode(code int) error {
+	if code < 100 || code > 999 {
+		return FastlyError{Status: FastlyStatusInval}
+	}
+	r.status = code
+	return nil
+}
+
+func (r *HTTPResponse) SetFramingHeadersMode(manual bool) error {
+	r.manualFraming = manual
+	return nil
+}
+
+func (r *HTTPResponse) GetAddrDestIP() (net.IP, error) {
+	if r.destIP == nil {
+		return nil, FastlyError{Status: FastlyStatusNone}
+	}
+	return r.destIP, nil
+}
+
+func (r *HTTPResponse) GetAddrDestPort() (uint16, error) {
+	if r.destIP == nil {
+		return 0, FastlyError{Status: FastlyStatusNone}
+	}
+	return r.destPort, nil
+}
@@ -0,0 +1,271 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KVStore is an in-memory KV store. Operations complete immediately, and
+// their results are collected by the corresponding Wait method.
+type KVStore struct {
+	mu         sync.Mutex
+	entries    map[string]kvEntry
+	generation uint64
+	next       handle
+	results    map[handle]kvResult
+}
+
+type kvEntry struct {
+	value      []byte
+	meta       []byte
+	generation uint64
+	expires    time.Time
+}
+
+type kvResult struct {
+	entry kvEntry
+	body  []byte
+	err   error
+}
+
+// NewKVStore returns an empty in-memory KV store, for use by a Host.
+func NewKVStore() *KVStore {
+	return &KVStore{
+		entries: make(map[string]kvEntry),
+		results: make(map[handle]kvResult),
+	}
+}
+
+func OpenKVStore(name string) (*KVStore, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	kv, ok := h.KVStore(name)
+	if !ok {
+		return nil, FastlyError{Status: FastlyStatusInval}
+	}
+	return kv, nil
+}
+
+// result stores r to be collected later, and returns its handle. The
+// caller must hold kv.mu.
+func (kv *KVStore) result(r kvResult) handle {
+	kv.next++
+	kv.results[kv.next] = r
+	return kv.next
+}
+
+func (kv *KVStore) take(h handle) (kvResult, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	r, ok := kv.results[h]
+	if !ok {
+		return kvResult{}, FastlyError{Status: FastlyStatusBadf}
+	}
+	delete(kv.results, h)
+	return r, nil
+}
+
+// lookup returns the live entry for key. The caller must hold kv.mu.
+func (kv *KVStore) lookup(key string) (kvEntry, bool) {
+	e, ok := kv.entries[key]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(kv.entries, key)
+		return kvEntry{}, false
+	}
+	return e, ok
+}
+
+func (kv *KVStore) Lookup(key string) (kvstoreLookupHandle, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if key == "" {
+		return 0, FastlyError{Status: FastlyStatusInval}
+	}
+	e, ok := kv.lookup(key)
+	if !ok {
+		return kvstoreLookupHandle(kv.result(kvResult{err: KVErrorNotFound})), nil
+	}
+	return kvstoreLookupHandle(kv.result(kvResult{entry: e})), nil
+}
+
+func (kv *KVStore) LookupWait(h kvstoreLookupHandle) (KVLookupResult, error) {
+	r, err := kv.take(handle(h))
+	if err != nil {
+		return KVLookupResult{}, err
+	}
+	if r.err != nil {
+		return KVLookupResult{}, r.err
+	}
+	return KVLookupResult{
+		Body:       newBodyFrom(r.entry.value),
+		Meta:       r.entry.meta,
+		Generation: r.entry.generation,
+	}, nil
+}
+
+func (kv *KVStore) Insert(key string, value io.Reader, config *KVInsertConfig) (kvstoreInsertHandle, error) {
+	if config == nil {
+		config = &KVInsertConfig{}
+	}
+	if key == "" {
+		return 0, FastlyError{Status: FastlyStatusInval}
+	}
+
+	// A body handle passed to the host is consumed whole, without being
+	// closed by its writer.
+	if b, ok := value.(*HTTPBody); ok {
+		b.Close()
+	}
+	data, err := io.ReadAll(value)
+	if err != nil {
+		return 0, err
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	old, exists := kv.lookup(key)
+	if config.mask&kvInsertConfigFlagIfGenerationMatch != 0 && (!exists || old.generation != uint64(config.opts.ifGenerationMatch)) {
+		return kvstoreInsertHandle(kv.result(kvResult{err: KVErrorPreconditionFailed})), nil
+	}
+
+	switch config.opts.mode {
+	case KVInsertModeAdd:
+		if exists {
+			return kvstoreInsertHandle(kv.result(kvResult{err: KVErrorPreconditionFailed})), nil
+		}
+	case KVInsertModeAppend:
+		data = append(append([]byte(nil), old.value...), data...)
+	case KVInsertModePrepend:
+		data = append(data, old.value...)
+	}
+
+	kv.generation++
+	e := kvEntry{value: data, generation: kv.generation}
+	if config.mask&kvInsertConfigFlagMetadata != 0 {
+		e.meta = append([]byte(nil), config.metadata...)
+	}
+	if config.mask&kvInsertConfigFlagTTLSec != 0 {
+		e.expires = time.Now().Add(time.Duration(config.opts.ttlSec) * time.Second)
+	}
+	kv.entries[key] = e
+
+	return kvstoreInsertHandle(kv.result(kvResult{})), nil
+}
+
+func (kv *KVStore) InsertWait(h kvstoreInsertHandle) error {
+	r, err := kv.take(handle(h))
+	if err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (kv *KVStore) Delete(key string) (kvstoreDeleteHandle, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if key == "" {
+		return 0, FastlyError{Status: FastlyStatusInval}
+	}
+	if _, ok := kv.lookup(key); !ok {
+		return kvstoreDeleteHandle(kv.result(kvResult{err: KVErrorNotFound})), nil
+	}
+	delete(kv.entries, key)
+	return kvstoreDeleteHandle(kv.result(kvResult{})), nil
+}
+
+func (kv *KVStore) DeleteWait(h kvstoreDeleteHandle) error {
+	r, err := kv.take(handle(h))
+	if err != nil {
+		return err
+	}
+	return r.err
+}
+
+// kvListDefaultLimit is the page size used when a list has no limit.
+const kvListDefaultLimit = 1000
+
+func (kv *KVStore) List(config *KVListConfig) (kvstoreListHandle, error) {
+	if config == nil {
+		config = &KVListConfig{}
+	}
+
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var keys []string
+	for k := range kv.entries {
+		if _, ok := kv.lookup(k); !ok {
+			continue
+		}
+		if config.mask&kvListConfigFlagPrefix != 0 && !strings.HasPrefix(k, config.prefix) {
+			continue
+		}
+		if config.mask&kvListConfigFlagCursor != 0 && k <= config.cursor {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	limit := kvListDefaultLimit
+	if config.mask&kvListConfigFlagLimit != 0 && config.opts.limit > 0 {
+		limit = int(config.opts.limit)
+	}
+
+	var next string
+	if len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1]
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+
+	mode := "strong"
+	if config.opts.mode == KVListModeEventual {
+		mode = "eventual"
+	}
+
+	type listMeta struct {
+		Limit      int    `json:"limit"`
+		NextCursor string `json:"next_cursor"`
+		Prefix     string `json:"prefix"`
+		Mode       string `json:"mode"`
+	}
+	page := struct {
+		Data []string `json:"data"`
+		Meta listMeta `json:"meta"`
+	}{
+		Data: keys,
+		Meta: listMeta{Limit: limit, NextCursor: next, Prefix: config.prefix, Mode: mode},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(page); err != nil {
+		return 0, err
+	}
+	return kvstoreListHandle(kv.result(kvResult{body: buf.Bytes()})), nil
+}
+
+func (kv *KVStore) ListWait(listH kvstoreListHandle) (*HTTPBody, error) {
+	r, err := kv.take(handle(listH))
+	if err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return newBodyFrom(r.body), nil
+}
@@ -0,0 +1,28 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+import "io"
+
+// LogEndpoint writes log events to the Host.
+type LogEndpoint struct {
+	w io.Writer
+}
+
+func GetLogEndpoint(name string) (*LogEndpoint, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	w := h.LogEndpoint(name)
+	if w == nil {
+		w = io.Discard
+	}
+	return &LogEndpoint{w: w}, nil
+}
+
+func (e *LogEndpoint) Write(p []byte) (n int, err error) {
+	return e.w.Write(p)
+}
@@ -0,0 +1,55 @@
+//go:build !wasip1 || nofastlyhostcalls
+
+// Copyright 2022 Fastly, Inc.
+
+package fastly
+
+type (
+	// SecretStore is a view of a secret store provided by the Host.
+	SecretStore struct {
+		m map[string][]byte
+	}
+
+	// Secret holds the plaintext of a secret.
+	Secret struct {
+		plaintext []byte
+	}
+)
+
+func OpenSecretStore(name string) (*SecretStore, error) {
+	h, err := getHost()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, FastlyError{Status: FastlyStatusInval}
+	}
+	m, ok := h.SecretStore(name)
+	if !ok {
+		return nil, FastlyError{Status: FastlyStatusNone}
+	}
+	return &SecretStore{m: m}, nil
+}
+
+func (s *SecretStore) Get(name string) (*Secret, error) {
+	if name == "" {
+		return nil, FastlyError{Status: FastlyStatusInval}
+	}
+	v, ok := s.m[name]
+	if !ok {
+		return nil, FastlyError{Status: FastlyStatusNone}
+	}
+	return &Secret{plaintext: v}, nil
+}
+
+func (s *Secret) Plaintext() ([]byte, error) {
+	return append([]byte(nil), s.plaintext...), nil
+}
+
+func (s *Secret) Handle() secretHandle {
+	return 0
+}
+
+func SecretFromBytes(b []byte) (*Secret, error) {
+	return &Secret{plaintext: append([]byte(nil), b...)}, nil
+}
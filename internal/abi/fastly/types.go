@@ -242,6 +242,22 @@ const (
 	HTTPVersionH3 HTTPVersion = 4
 )
 
+// HTTPVersionFor returns the HTTPVersion with the given major and minor
+// version numbers, and false if there is none. HTTP/0.9 is not supported.
+func HTTPVersionFor(major, minor int) (HTTPVersion, bool) {
+	switch {
+	case major == 1 && minor == 0:
+		return HTTPVersionHTTP10, true
+	case major == 1 && minor == 1:
+		return HTTPVersionHTTP11, true
+	case major == 2 && minor == 0:
+		return HTTPVersionH2, true
+	case major == 3 && minor == 0:
+		return HTTPVersionH3, true
+	}
+	return 0, false
+}
+
 func (v HTTPVersion) splat() (proto string, major, minor int, err error) {
 	switch v {
 	case HTTPVersionHTTP09:
@@ -643,6 +659,10 @@ type kvInsertConfig struct {
 type KVInsertConfig struct {
 	mask kvInsertConfigMask
 	opts kvInsertConfig
+
+	// metadata is kept for builds without hostcalls, where the
+	// pointer in opts cannot be followed.
+	metadata []byte
 }
 
 func (c *KVInsertConfig) Mode(mode KVInsertMode) {
@@ -655,6 +675,7 @@ func (c *KVInsertConfig) BackgroundFetch() {
 
 func (c *KVInsertConfig) Metadata(meta []byte) {
 	c.mask |= kvInsertConfigFlagMetadata
+	c.metadata = meta
 	buf := prim.NewReadBufferFromBytes(meta)
 	c.opts.metadataPtr = prim.ToPointer(buf.Char8Pointer())
 	c.opts.metadataLen = prim.U32(buf.Len())
@@ -726,6 +747,11 @@ type kvListConfig struct {
 type KVListConfig struct {
 	mask kvListConfigMask
 	opts kvListConfig
+
+	// cursor and prefix are kept for builds without hostcalls, where
+	// the pointers in opts cannot be followed.
+	cursor string
+	prefix string
 }
 
 func (c *KVListConfig) Mode(mode KVListMode) {
@@ -734,6 +760,7 @@ func (c *KVListConfig) Mode(mode KVListMode) {
 
 func (c *KVListConfig) Cursor(cursor string) {
 	c.mask |= kvListConfigFlagCursor
+	c.cursor = cursor
 	buf := prim.NewReadBufferFromString(cursor)
 	c.opts.cursorPtr = prim.ToPointer(buf.Char8Pointer())
 	c.opts.cursorLen = prim.U32(buf.Len())
@@ -746,6 +773,7 @@ func (c *KVListConfig) Limit(limit uint32) {
 
 func (c *KVListConfig) Prefix(cursor string) {
 	c.mask |= kvListConfigFlagPrefix
+	c.prefix = cursor
 	buf := prim.NewReadBufferFromString(cursor)
 	c.opts.prefixPtr = prim.ToPointer(buf.Char8Pointer())
 	c.opts.prefixLen = prim.U32(buf.Len())
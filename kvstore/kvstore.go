@@ -89,6 +89,21 @@ func (e *Entry) String() string {
 	return e.s
 }
 
+// Size returns the length of the entry's value in bytes, or -1 if it is not
+// known. It must be called before the value is read. Together with Read, it
+// allows an Entry to be served with fsthttp.ServeSizedReader.
+func (e *Entry) Size() int64 {
+	b, ok := e.Reader.(*fastly.HTTPBody)
+	if !ok {
+		return -1
+	}
+	n, err := b.Length()
+	if err != nil {
+		return -1
+	}
+	return int64(n)
+}
+
 func (e *Entry) Meta() []byte {
 	return e.meta
 }
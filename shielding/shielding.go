@@ -1,13 +1,23 @@
 package shielding
 
-import (
-	"github.com/fastly/compute-sdk-go/internal/abi/fastly"
-)
+import "github.com/fastly/compute-sdk-go/internal/abi/fastly"
+
+// backendForShield is the hostcall behind Shield.Backend, replaced in
+// tests.
+var backendForShield = func(name, cacheKey string) (string, error) {
+	var abiOpts fastly.ShieldingBackendOptions
+	if cacheKey != "" {
+		abiOpts.CacheKey(cacheKey)
+	}
+	return fastly.ShieldingBackendForShield(name, &abiOpts)
+}
 
 // Shield is a shielding site within Fastly.
 type Shield struct {
 	name      string
 	runningOn bool
+	target    string
+	sslTarget string
 }
 
 // ShieldFromName returns information about a particular shield site.
@@ -20,6 +30,8 @@ func ShieldFromName(n string) (*Shield, error) {
 	return &Shield{
 		name:      n,
 		runningOn: info.RunningOn(),
+		target:    info.Target(),
+		sslTarget: info.SSLTarget(),
 	}, nil
 }
 
@@ -29,12 +41,31 @@ func (s *Shield) Name() string { return s.name }
 // IsRunningOn returns whether the Compute node is currently in the shielding site.
 func (s *Shield) IsRunningOn() bool { return s.runningOn }
 
-// BackendOptions
+// Target returns the host used to reach the shield site without TLS. It
+// is empty if the Compute node is running on the shield site.
+func (s *Shield) Target() string { return s.target }
+
+// SSLTarget returns the host used to reach the shield site with TLS. It is
+// empty if the Compute node is running on the shield site.
+func (s *Shield) SSLTarget() string { return s.sslTarget }
+
+// BackendOptions configures the backend returned by Shield.Backend. The zero
+// value, like a nil *BackendOptions, uses the default settings.
+//
+// The cache key is the only setting the shield backend accepts. The
+// timeouts, TLS and pooling of the connection to the shield site are
+// managed by Fastly and cannot be changed.
 type BackendOptions struct {
+	// CacheKey sets the cache key used for requests sent to the shield
+	// site in place of the one derived from the request.
+	CacheKey string
 }
 
 // Backend returns a named backend for use with the fsthttp package.
 func (s *Shield) Backend(opts *BackendOptions) (string, error) {
-	var abiOpts fastly.ShieldingBackendOptions
-	return fastly.ShieldingBackendForShield(s.name, &abiOpts)
+	var cacheKey string
+	if opts != nil {
+		cacheKey = opts.CacheKey
+	}
+	return backendForShield(s.name, cacheKey)
 }
@@ -0,0 +1,80 @@
+// Copyright 2022 Fastly, Inc.
+
+package shielding
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShieldTargets(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		shield    Shield
+		runningOn bool
+		target    string
+		sslTarget string
+	}{
+		{Shield{name: "iad", target: "iad.shield.example", sslTarget: "iad-ssl.shield.example"}, false, "iad.shield.example", "iad-ssl.shield.example"},
+		{Shield{name: "lhr", runningOn: true}, true, "", ""},
+	} {
+		s := tt.shield
+		if got := s.IsRunningOn(); got != tt.runningOn {
+			t.Errorf("%s: IsRunningOn = %v, want %v", s.Name(), got, tt.runningOn)
+		}
+		if got := s.Target(); got != tt.target {
+			t.Errorf("%s: Target = %q, want %q", s.Name(), got, tt.target)
+		}
+		if got := s.SSLTarget(); got != tt.sslTarget {
+			t.Errorf("%s: SSLTarget = %q, want %q", s.Name(), got, tt.sslTarget)
+		}
+	}
+}
+
+func TestShieldBackend(t *testing.T) {
+	orig := backendForShield
+	t.Cleanup(func() { backendForShield = orig })
+
+	var gotName, gotKey string
+	backendForShield = func(name, cacheKey string) (string, error) {
+		gotName, gotKey = name, cacheKey
+		if name == "bad" {
+			return "", errors.New("no such shield")
+		}
+		return "backend-" + name, nil
+	}
+
+	s := &Shield{name: "iad"}
+	for _, tt := range []struct {
+		name string
+		opts *BackendOptions
+		key  string
+	}{
+		{"nil options", nil, ""},
+		{"zero options", &BackendOptions{}, ""},
+		{"cache key", &BackendOptions{CacheKey: "products"}, "products"},
+	} {
+		var before BackendOptions
+		if tt.opts != nil {
+			before = *tt.opts
+		}
+		backend, err := s.Backend(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: Backend: %v", tt.name, err)
+		}
+		if backend != "backend-iad" || gotName != "iad" {
+			t.Errorf("%s: Backend = %q for shield %q, want %q for %q", tt.name, backend, gotName, "backend-iad", "iad")
+		}
+		if gotKey != tt.key {
+			t.Errorf("%s: cache key = %q, want %q", tt.name, gotKey, tt.key)
+		}
+		if tt.opts != nil && *tt.opts != before {
+			t.Errorf("%s: options changed to %+v", tt.name, *tt.opts)
+		}
+	}
+
+	if _, err := (&Shield{name: "bad"}).Backend(&BackendOptions{CacheKey: "k"}); err == nil {
+		t.Errorf("Backend: no error for a failing hostcall")
+	}
+}